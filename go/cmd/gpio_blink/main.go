@@ -2,6 +2,8 @@ package main
 
 import (
 	"bbai64/gpio"
+	"bbai64/registry"
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -10,50 +12,64 @@ import (
 )
 
 func main() {
+	defer registry.Recover()
 	led, err := gpio.Export(gpio.P8_03)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	defer led.Unexport()
+	led.SetSafeState(gpio.SafeState{Direction: gpio.IN})
+	defer led.Release()
 	led.SetDirection(gpio.OUT)
-	defer led.SetDirection(gpio.IN)
 
 	button, err := gpio.Export(gpio.P8_04)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	defer button.Unexport()
+	button.SetSafeState(gpio.SafeState{Direction: gpio.IN, Edge: gpio.NONE})
+	defer button.Release()
 	button.SetDirection(gpio.IN)
-	button.SetEdge(gpio.RISING)
-	defer button.SetEdge(gpio.NONE)
+	button.SetEdge(gpio.BOTH)
 
-	buttonChan := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	buttonEvents, err := button.DebouncedEvents(ctx, gpio.DebounceConfig{Stable: 20 * time.Millisecond})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 	terminateChan := make(chan os.Signal, 1)
 	signal.Notify(terminateChan, syscall.SIGINT, syscall.SIGTERM)
 
-	go func() {
-		button.Poll()
-		buttonChan <- struct{}{}
-	}()
-
 	ledStates := [...]gpio.Value{gpio.HIGH, gpio.LOW}
 	ledStateIndx := 0
 
 	fmt.Println("Start blinking.")
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	led.SetValue(ledStates[ledStateIndx])
 blinking:
 	for {
-		led.SetValue(ledStates[ledStateIndx])
-		ledStateIndx = (ledStateIndx + 1) % len(ledStates)
 		select {
-		case <-buttonChan:
-			fmt.Println("Button was pressed.")
+		case event, ok := <-buttonEvents:
+			if !ok {
+				// the stream ends on a read error, keep blinking until terminated
+				fmt.Println("Button events stopped.")
+				buttonEvents = nil
+				continue
+			}
+			if event.Edge != gpio.RISING {
+				continue
+			}
+			fmt.Printf("Button was pressed at %v.\n", event.Timestamp)
 			break blinking
 		case <-terminateChan:
 			fmt.Println("Program was terminated.")
 			break blinking
-		case <-time.After(time.Second):
+		case <-ticker.C:
+			ledStateIndx = (ledStateIndx + 1) % len(ledStates)
+			led.SetValue(ledStates[ledStateIndx])
 		}
 	}
 	fmt.Println("Stop blinking.")
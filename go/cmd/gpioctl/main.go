@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bbai64/gpio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json jsoniter.API = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const USAGE = `Usage: gpioctl [flags] <command> [arguments]
+
+Commands:
+  get PIN...         print the value of the pins
+  set PIN VALUE      make the pin an output driving VALUE (0, 1, low or high)
+  toggle PIN         make the pin an output driving the opposite of its current value
+  monitor PIN...     print the edges of the pins until interrupted
+  info PIN...        print the number, chip, offset, user, direction, edge and value of the pins
+  list               print the state of every header pin
+
+PIN is an alias like "P9_22A" or a header pin name like "P9_22".
+
+set and toggle release the pin before exiting. The sysfs backend leaves the line
+driving the value, with the cdev backend the state of a released line is undefined
+and it may go back to its default: use --hold to keep driving it until interrupted.
+--bias and --active-low apply to get, set, toggle and monitor. info and list only
+read the line info, they neither request nor export the pins, so pins in use by other
+processes are shown too. The value is only known for pins exported in sysfs.
+
+Flags:
+`
+
+var jsonOutput = flag.Bool("json", false, "print JSON instead of text, one object per line for monitor")
+var edgeFlag = flag.String("edge", string(gpio.BOTH), "edges to monitor: rising, falling or both")
+var debounceFlag = flag.Duration("debounce", 0, "debounce monitored edges for the given stable time")
+var biasFlag = flag.String("bias", string(gpio.AS_IS), "bias to apply: as-is, disabled, pull-up or pull-down")
+var activeLowFlag = flag.Bool("active-low", false, "treat the pins as active low")
+var holdFlag = flag.Bool("hold", false, "keep driving the pin after set or toggle until interrupted")
+
+type PinState struct {
+	Pin       string         `json:"pin"`
+	Alias     gpio.Alias     `json:"alias"`
+	Number    gpio.Number    `json:"number"`
+	Chip      string         `json:"chip,omitempty"`
+	Offset    int            `json:"offset"`
+	Used      bool           `json:"used"`
+	Consumer  string         `json:"consumer,omitempty"`
+	Direction gpio.Direction `json:"direction,omitempty"`
+	Edge      gpio.Edge      `json:"edge,omitempty"`
+	Value     *gpio.Value    `json:"value,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+type PinEvent struct {
+	Pin   string     `json:"pin"`
+	Alias gpio.Alias `json:"alias"`
+	gpio.Event
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), USAGE)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	command, args := flag.Arg(0), flag.Args()[1:]
+	var err error
+	switch command {
+	case "get":
+		err = get(args)
+	case "set":
+		err = set(args)
+	case "toggle":
+		err = toggle(args)
+	case "monitor":
+		err = monitor(args)
+	case "info":
+		err = info(args)
+	case "list":
+		err = list()
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gpioctl:", err)
+		os.Exit(1)
+	}
+}
+
+func lookup(name string) (gpio.HeaderPin, error) {
+	pin, ok := gpio.LookupHeaderPin(name)
+	if !ok {
+		return pin, fmt.Errorf("unknown pin %q", name)
+	}
+	return pin, nil
+}
+
+// exportOptions returns the options from the --bias and --active-low flags
+func exportOptions() []gpio.Option {
+	options := []gpio.Option{}
+	if gpio.Bias(*biasFlag) != gpio.AS_IS {
+		options = append(options, gpio.WithBias(gpio.Bias(*biasFlag)))
+	}
+	if *activeLowFlag {
+		options = append(options, gpio.WithActiveLow())
+	}
+	return options
+}
+
+func exportByName(name string) (gpio.HeaderPin, *gpio.Pin, error) {
+	header, err := lookup(name)
+	if err != nil {
+		return header, nil, err
+	}
+	pin, err := gpio.Export(header.Alias, exportOptions()...)
+	return header, pin, err
+}
+
+func parseValue(s string) (gpio.Value, error) {
+	switch strings.ToLower(s) {
+	case "0", "low":
+		return gpio.LOW, nil
+	case "1", "high":
+		return gpio.HIGH, nil
+	}
+	return gpio.LOW, fmt.Errorf("invalid value %q, expected 0, 1, low or high", s)
+}
+
+// lineState reads the state of a header pin without requesting or exporting it,
+// failures are reported in the state
+func lineState(header gpio.HeaderPin) PinState {
+	state := PinState{Pin: header.Name(), Alias: header.Alias, Number: -1, Offset: -1}
+	line, err := gpio.Inspect(header.Alias)
+	if line.Chip != "" {
+		state.Number = line.Number
+		state.Chip = line.Chip
+		state.Offset = line.Offset
+	}
+	if err != nil {
+		state.Error = err.Error()
+		return state
+	}
+	state.Used = line.Used
+	state.Consumer = line.Consumer
+	state.Direction = line.Direction
+	state.Edge = line.Edge
+	state.Value = line.Value
+	return state
+}
+
+// inspect reads the state of a header pin exported with the options, failures are reported in the state
+func inspect(header gpio.HeaderPin, options ...gpio.Option) PinState {
+	state := PinState{Pin: header.Name(), Alias: header.Alias, Number: -1, Offset: -1}
+	pin, err := gpio.Export(header.Alias, options...)
+	if err != nil {
+		state.Error = err.Error()
+		return state
+	}
+	defer pin.Unexport()
+	state.Number = pin.Number()
+	state.Chip = pin.Chip()
+	state.Offset = pin.Offset()
+	errs := []string{}
+	if state.Direction, err = pin.Direction(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if state.Edge, err = pin.Edge(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if value, err := pin.Value(); err != nil {
+		errs = append(errs, err.Error())
+	} else {
+		state.Value = &value
+	}
+	state.Error = strings.Join(errs, "; ")
+	return state
+}
+
+func get(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("get needs at least one pin")
+	}
+	states := []PinState{}
+	for _, name := range args {
+		header, err := lookup(name)
+		if err != nil {
+			return err
+		}
+		state := inspect(header, exportOptions()...)
+		if state.Value == nil {
+			return fmt.Errorf("unable to read %s: %s", name, state.Error)
+		}
+		states = append(states, state)
+	}
+	if *jsonOutput {
+		return printJSON(states)
+	}
+	for _, state := range states {
+		fmt.Printf("%s=%d\n", state.Pin, *state.Value)
+	}
+	return nil
+}
+
+func drive(pin *gpio.Pin, value gpio.Value) error {
+	if err := pin.SetDirection(gpio.OUT); err != nil {
+		return err
+	}
+	return pin.SetValue(value)
+}
+
+// hold keeps the pin requested until interrupted if --hold is set
+func hold() {
+	if !*holdFlag {
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+}
+
+func set(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("set needs a pin and a value")
+	}
+	value, err := parseValue(args[1])
+	if err != nil {
+		return err
+	}
+	header, pin, err := exportByName(args[0])
+	if err != nil {
+		return err
+	}
+	defer pin.Unexport()
+	if err := drive(pin, value); err != nil {
+		return err
+	}
+	if err := printValue(header, value); err != nil {
+		return err
+	}
+	hold()
+	return nil
+}
+
+func toggle(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("toggle needs a pin")
+	}
+	header, pin, err := exportByName(args[0])
+	if err != nil {
+		return err
+	}
+	defer pin.Unexport()
+	value, err := pin.Value()
+	if err != nil {
+		return err
+	}
+	value = 1 - value
+	if err := drive(pin, value); err != nil {
+		return err
+	}
+	if err := printValue(header, value); err != nil {
+		return err
+	}
+	hold()
+	return nil
+}
+
+func printValue(header gpio.HeaderPin, value gpio.Value) error {
+	if *jsonOutput {
+		return printJSON(PinState{Pin: header.Name(), Alias: header.Alias, Value: &value, Direction: gpio.OUT})
+	}
+	fmt.Printf("%s=%d\n", header.Name(), value)
+	return nil
+}
+
+func monitor(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("monitor needs at least one pin")
+	}
+	edge := gpio.Edge(*edgeFlag)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	merged := make(chan PinEvent, gpio.EVENTS_BUFFER_SIZE)
+	for _, name := range args {
+		header, pin, err := exportByName(name)
+		if err != nil {
+			return err
+		}
+		pin.SetSafeState(gpio.SafeState{Direction: gpio.IN, Edge: gpio.NONE})
+		defer pin.Release()
+		if err := pin.SetDirection(gpio.IN); err != nil {
+			return err
+		}
+		var events <-chan gpio.Event
+		if *debounceFlag > 0 {
+			if err := pin.SetEdge(gpio.BOTH); err != nil {
+				return err
+			}
+			events, err = pin.DebouncedEvents(ctx, gpio.DebounceConfig{Stable: *debounceFlag})
+		} else {
+			if err := pin.SetEdge(edge); err != nil {
+				return err
+			}
+			events, err = pin.Events(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		go func() {
+			for event := range events {
+				if edge != gpio.BOTH && event.Edge != edge {
+					continue
+				}
+				merged <- PinEvent{Pin: header.Name(), Alias: header.Alias, Event: event}
+			}
+		}()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-merged:
+			if *jsonOutput {
+				printJSON(event)
+				continue
+			}
+			// seconds of CLOCK_MONOTONIC, like the kernel log
+			fmt.Printf("%14.6f %s %s #%d\n", event.Timestamp.Seconds(), event.Pin, event.Edge, event.Seqno)
+		}
+	}
+}
+
+func info(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("info needs at least one pin")
+	}
+	states := []PinState{}
+	for _, name := range args {
+		header, err := lookup(name)
+		if err != nil {
+			return err
+		}
+		states = append(states, lineState(header))
+	}
+	return printStates(states)
+}
+
+func list() error {
+	states := []PinState{}
+	for _, header := range gpio.HeaderPins {
+		states = append(states, lineState(header))
+	}
+	return printStates(states)
+}
+
+func printStates(states []PinState) error {
+	if *jsonOutput {
+		return printJSON(states)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PIN\tALIAS\tNUMBER\tCHIP:OFFSET\tUSER\tDIRECTION\tEDGE\tVALUE\tERROR")
+	for _, state := range states {
+		location := "-"
+		if state.Chip != "" {
+			location = fmt.Sprintf("%s:%d", state.Chip, state.Offset)
+		}
+		number := "-"
+		if state.Number >= 0 {
+			number = fmt.Sprint(state.Number)
+		}
+		value := "-"
+		if state.Value != nil {
+			value = fmt.Sprint(*state.Value)
+		}
+		user := state.Consumer
+		if state.Used && user == "" {
+			user = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			state.Pin, state.Alias, number, location, orDash(user), orDash(string(state.Direction)), orDash(string(state.Edge)), value, state.Error)
+	}
+	return w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func printJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bbai64/i2c"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json jsoniter.API = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const USAGE = `Usage: i2cscan [flags]
+
+Probes every valid 7-bit address of the bus and names the known parts which can answer there.
+Parts with a chip id register are only named if the id matches, the others are guesses from the address.
+
+Flags:
+`
+
+var busFlag = flag.Int("bus", int(i2c.Bus1), "i2c bus number, see "+i2c.DevicePath)
+var jsonOutput = flag.Bool("json", false, "print JSON instead of a table")
+var identifyFlag = flag.Bool("identify", true, "read the chip id registers of the known parts to identify them")
+
+type Part struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Identified  bool   `json:"identified"`
+}
+
+type Result struct {
+	Address  string       `json:"address"`
+	Presence i2c.Presence `json:"presence"`
+	Parts    []Part       `json:"parts"`
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), USAGE)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := scan(i2c.BusNumber(*busFlag)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func scan(busNumber i2c.BusNumber) error {
+	bus, err := i2c.Open(busNumber)
+	if err != nil {
+		return fmt.Errorf("unable to open i2c bus %d: %w", busNumber, err)
+	}
+	defer bus.Close()
+	found, err := bus.Scan()
+	if err != nil {
+		return err
+	}
+	results := []Result{}
+	for _, device := range found {
+		result := Result{
+			Address:  fmt.Sprintf("0x%02x", device.Address),
+			Presence: device.Presence,
+			Parts:    []Part{},
+		}
+		for _, signature := range identify(bus, device) {
+			result.Parts = append(result.Parts, Part{
+				Name:        signature.Name,
+				Description: signature.Description,
+				Identified:  signature.ID != nil,
+			})
+		}
+		results = append(results, result)
+	}
+	if *jsonOutput {
+		return json.NewEncoder(os.Stdout).Encode(results)
+	}
+	printTable(results)
+	return nil
+}
+
+// identify reads the chip ids of the present devices, a claimed device belongs to a kernel driver
+// and is left alone. Without reading, only the parts without a chip id can be guessed from the address.
+func identify(bus *i2c.Bus, device i2c.Found) []i2c.Signature {
+	if *identifyFlag && device.Presence == i2c.PRESENT {
+		return bus.Identify(device.Address)
+	}
+	signatures := []i2c.Signature{}
+	for _, signature := range i2c.Candidates(device.Address) {
+		if signature.ID == nil {
+			signatures = append(signatures, signature)
+		}
+	}
+	return signatures
+}
+
+func printTable(results []Result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDRESS\tPRESENCE\tPARTS")
+	for _, result := range results {
+		parts := []string{}
+		for _, part := range result.Parts {
+			name := part.Name
+			if !part.Identified {
+				name += "?"
+			}
+			parts = append(parts, fmt.Sprintf("%s (%s)", name, part.Description))
+		}
+		if len(parts) == 0 {
+			parts = append(parts, "-")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.Address, result.Presence, strings.Join(parts, ", "))
+	}
+	w.Flush()
+}
@@ -13,7 +13,7 @@ func main() {
 		log.Fatal("Can not open i2c bus 1")
 	}
 	defer bus.Close()
-	ina219 := ina219.New(bus, ina219.ADDRESS_DEFAULT)
+	ina219 := ina219.New(bus.Device(ina219.ADDRESS_DEFAULT))
 	if err := ina219.SetCalibration32Volts2Amps(); err != nil {
 		log.Fatal("Can not initialize ina219")
 	}
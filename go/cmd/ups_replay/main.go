@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bbai64/i2c"
+	"bbai64/ina219"
+	"bbai64/ups"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json jsoniter.API = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const USAGE = `Usage: ups_replay [flags] TRACE
+
+Runs the ups module on the ina219 transfers of a trace recorded with I2C_TRACE=TRACE
+and prints its status as JSON after every refresh. It fails if the ups module
+does not make the recorded transfers.
+
+Flags:
+`
+
+var periodFlag = flag.Duration("period", 10*time.Millisecond, "refresh period of the ups module")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), USAGE)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	replay, err := i2c.OpenReplay(flag.Arg(0), ina219.ADDRESS_DEFAULT)
+	if err != nil {
+		log.Fatal(err)
+	}
+	upsModule := ups.NewUpsModule3SWithDevice(i2c.NewDevice(replay, ina219.ADDRESS_DEFAULT))
+	encoder := json.NewEncoder(os.Stdout)
+	done := make(chan error, 1)
+	upsModule.OnRefresh = func(status ups.UpsModuleStatus, err error) {
+		encoder.Encode(status)
+		switch {
+		case errors.Is(err, i2c.ErrReplayMismatch), errors.Is(err, i2c.ErrReplayEnd):
+			finish(done, err)
+		case replay.Remaining() == 0:
+			finish(done, nil)
+		}
+	}
+	go upsModule.Run(*periodFlag)
+	err = <-done
+	upsModule.Stop()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// finish reports the end of the replay once, the refreshes after it are ignored
+func finish(done chan<- error, err error) {
+	select {
+	case done <- err:
+	default:
+	}
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"bbai64/gpio"
 	"bbai64/gstpipeline"
+	"bbai64/hcsr04"
 	"bbai64/i2c"
+	"bbai64/pwm"
+	"bbai64/registry"
+	"bbai64/tone"
 	"bbai64/twowheeled"
 	"bbai64/ups"
+	"context"
 	"errors"
 	"io"
 	"log"
@@ -30,6 +36,15 @@ const CAMERA_HEIGHT = 1080
 const RESCALE_WIDTH = 1280
 const RESCALE_HEIGHT = 720
 const JPEG_QUALITY = 50
+const RANGE_FINDER_TRIGGER = gpio.P8_07
+const RANGE_FINDER_ECHO = gpio.P8_08
+const RANGE_FINDER_SAMPLES = 3
+const RANGE_FINDER_PERIOD = 100 * time.Millisecond
+const OBSTACLE_DISTANCE_MIN = 0.3
+const BUZZER_PWM_BUS = pwm.Bus2
+const BUZZER_PWM_CHANNEL = pwm.ChannelA
+const BATTERY_LOW_CHARGE = 15.0
+const BATTERY_ALARM_PERIOD = 30 * time.Second
 
 type Chunk struct {
 	Data [MJPEG_STREAM_CHUNK_SIZE]byte
@@ -43,16 +58,75 @@ var wsUpgrader = websocket.Upgrader{
 }
 
 type SystemStatus struct {
-	Battery ups.UpsModuleStatus `json:"battery"`
+	Battery  ups.UpsModuleStatus `json:"battery"`
+	Obstacle float64             `json:"obstacle"` // distance in meters, 0 if nothing is in range
 }
 
 var upsModule *ups.UpsModule3S
+var buzzer *tone.Player
+var melodyConnected = tone.MustParseRTTTL("connected:d=16,o=6,b=180:c,e,g")
+var melodyDisconnected = tone.MustParseRTTTL("disconnected:d=16,o=6,b=180:g,e,c")
+var melodyLowBattery = tone.MustParseRTTTL("lowbattery:d=8,o=7,b=240:a,p,a,p,a")
 var wsMutex sync.Mutex
+var obstacleMutex sync.RWMutex
+var obstacleDistance float64
 
 func checkOrigin(r *http.Request) bool {
 	return true
 }
 
+func runRangeFinder() {
+	trigger, err := gpio.Export(RANGE_FINDER_TRIGGER)
+	if err != nil {
+		log.Print("Range finder is not available: ", err)
+		return
+	}
+	trigger.SetSafeState(gpio.SafeState{Direction: gpio.OUT, Value: gpio.LOW})
+	defer trigger.Release()
+	echo, err := gpio.Export(RANGE_FINDER_ECHO)
+	if err != nil {
+		log.Print("Range finder is not available: ", err)
+		return
+	}
+	echo.SetSafeState(gpio.SafeState{Direction: gpio.IN, Edge: gpio.NONE})
+	defer echo.Release()
+	rangeFinder, err := hcsr04.New(trigger, echo)
+	if err != nil {
+		log.Print("Could not initialize range finder: ", err)
+		return
+	}
+	for {
+		distance, err := rangeFinder.MeasureMedian(context.Background(), RANGE_FINDER_SAMPLES)
+		if err != nil {
+			distance = 0
+		}
+		obstacleMutex.Lock()
+		obstacleDistance = distance
+		obstacleMutex.Unlock()
+		time.Sleep(RANGE_FINDER_PERIOD)
+	}
+}
+
+func runBatteryAlarm() {
+	for {
+		status := upsModule.Status()
+		// the voltage stays 0 until the first reading
+		if status.BatteryVoltage > 0 && status.ChargePercents < BATTERY_LOW_CHARGE {
+			log.Printf("Battery is low: %.0f%%", status.ChargePercents)
+			buzzer.Play(melodyLowBattery, tone.PRIORITY_ALARM)
+			time.Sleep(BATTERY_ALARM_PERIOD)
+			continue
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func obstacle() float64 {
+	obstacleMutex.RLock()
+	defer obstacleMutex.RUnlock()
+	return obstacleDistance
+}
+
 func serveVehicleControlWSRequest(w http.ResponseWriter, r *http.Request) {
 	if !wsMutex.TryLock() {
 		log.Print("Websocket multiple connections are not allowed with ", r.Host)
@@ -65,6 +139,7 @@ func serveVehicleControlWSRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	log.Print("Websocket connection established with ", r.Host)
+	buzzer.Play(melodyConnected, tone.PRIORITY_CHIME)
 	defer conn.Close()
 	vehicleState := &twowheeled.State{}
 	systemStatus := &SystemStatus{}
@@ -80,6 +155,11 @@ func serveVehicleControlWSRequest(w http.ResponseWriter, r *http.Request) {
 			log.Print("Websocket command format error: ", err)
 			break
 		}
+		systemStatus.Obstacle = obstacle()
+		if systemStatus.Obstacle > 0 && systemStatus.Obstacle < OBSTACLE_DISTANCE_MIN &&
+			len(vehicleState.Inputs) == 2 && vehicleState.Inputs[1] > 0 {
+			vehicleState.Inputs[1] = 0
+		}
 		twowheeled.UpdateWithState(vehicleState)
 		systemStatus.Battery = upsModule.Status()
 		message, _ = json.Marshal(systemStatus)
@@ -90,19 +170,20 @@ func serveVehicleControlWSRequest(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	twowheeled.Reset()
+	buzzer.Play(melodyDisconnected, tone.PRIORITY_CHIME)
 	log.Print("Websocket connection terminated with ", r.Host)
 }
 
 func serveMjpegStreamTcpSocket(strmr *streamer.Streamer[Chunk], address string) {
 	soc, err := net.Listen("tcp", address)
 	if err != nil {
-		log.Fatal("Cannot open socket at ", address, " : ", err)
+		registry.Fatal("Cannot open socket at ", address, " : ", err)
 	}
 	for {
 		log.Print("Waiting for input stream at ", address)
 		conn, err := soc.Accept()
 		if err != nil {
-			log.Fatal("Cannot accept socket connection at ", address, " : ", err)
+			registry.Fatal("Cannot accept socket connection at ", address, " : ", err)
 		}
 		serveMjpegStreamTcpSocketConnection(conn, strmr, address)
 		conn.Close()
@@ -174,9 +255,16 @@ func makeMjpegStreamer(inputAddr string, outputAddr string) *streamer.Streamer[C
 }
 
 func main() {
+	defer registry.ReleaseAll()
+	defer registry.Recover()
+	registry.HandleSignals()
 	upsModule = ups.NewUpsModule3S(i2c.Bus1)
 	go upsModule.Run(time.Second)
 	defer upsModule.Stop()
+	buzzer = tone.NewPlayer(pwm.NewPWM(BUZZER_PWM_BUS, BUZZER_PWM_CHANNEL))
+	defer buzzer.Close()
+	registry.Go(runBatteryAlarm)
+	registry.Go(runRangeFinder)
 
 	twowheeled.Initialize()
 	strmr := makeMjpegStreamer(":9990", "/mjpeg_stream")
@@ -187,6 +275,6 @@ func main() {
 	http.HandleFunc("/ws", serveVehicleControlWSRequest)
 	http.Handle("/", http.FileServer(http.Dir("./public")))
 	if err := http.ListenAndServe(SERVER_ADDRESS, nil); !errors.Is(err, http.ErrServerClosed) {
-		log.Fatal("Unable to start HTTP server: ", err)
+		registry.Fatal("Unable to start HTTP server: ", err)
 	}
 }
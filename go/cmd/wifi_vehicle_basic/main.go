@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bbai64/gpio"
 	"bbai64/gstpipeline"
+	"bbai64/hcsr04"
 	"bbai64/i2c"
+	"bbai64/pwm"
+	"bbai64/rc"
+	"bbai64/registry"
+	"bbai64/tone"
 	"bbai64/ups"
 	"bbai64/vehicle"
+	"context"
 	"errors"
 	"io"
 	"log"
@@ -30,6 +37,19 @@ const CAMERA_HEIGHT = 1080
 const RESCALE_WIDTH = 1280
 const RESCALE_HEIGHT = 720
 const JPEG_QUALITY = 50
+const RANGE_FINDER_TRIGGER = gpio.P8_07
+const RANGE_FINDER_ECHO = gpio.P8_08
+const RANGE_FINDER_SAMPLES = 3
+const RANGE_FINDER_PERIOD = 100 * time.Millisecond
+const OBSTACLE_DISTANCE_MIN = 0.3
+const BUZZER_PWM_BUS = pwm.Bus2
+const BUZZER_PWM_CHANNEL = pwm.ChannelA
+const BATTERY_LOW_CHARGE = 15.0
+const BATTERY_ALARM_PERIOD = 30 * time.Second
+const RC_STEERING = gpio.P8_14
+const RC_THROTTLE = gpio.P8_15
+const RC_MODE = gpio.P8_16
+const RC_UPDATE_PERIOD = 20 * time.Millisecond
 
 type Chunk struct {
 	Data [MJPEG_STREAM_CHUNK_SIZE]byte
@@ -43,16 +63,133 @@ var wsUpgrader = websocket.Upgrader{
 }
 
 type SystemStatus struct {
-	Battery ups.UpsModuleStatus `json:"battery"`
+	Battery  ups.UpsModuleStatus `json:"battery"`
+	Obstacle float64             `json:"obstacle"` // distance in meters, 0 if nothing is in range
+	Mode     rc.Mode             `json:"mode"`
 }
 
 var upsModule *ups.UpsModule3S
+var buzzer *tone.Player
+var melodyConnected = tone.MustParseRTTTL("connected:d=16,o=6,b=180:c,e,g")
+var melodyDisconnected = tone.MustParseRTTTL("disconnected:d=16,o=6,b=180:g,e,c")
+var melodyLowBattery = tone.MustParseRTTTL("lowbattery:d=8,o=7,b=240:a,p,a,p,a")
 var wsMutex sync.Mutex
+var obstacleMutex sync.RWMutex
+var obstacleDistance float64
+var modeMutex sync.RWMutex
+var controlMode rc.Mode = rc.WEB
 
 func checkOrigin(r *http.Request) bool {
 	return true
 }
 
+func runRangeFinder() {
+	trigger, err := gpio.Export(RANGE_FINDER_TRIGGER)
+	if err != nil {
+		log.Print("Range finder is not available: ", err)
+		return
+	}
+	trigger.SetSafeState(gpio.SafeState{Direction: gpio.OUT, Value: gpio.LOW})
+	defer trigger.Release()
+	echo, err := gpio.Export(RANGE_FINDER_ECHO)
+	if err != nil {
+		log.Print("Range finder is not available: ", err)
+		return
+	}
+	echo.SetSafeState(gpio.SafeState{Direction: gpio.IN, Edge: gpio.NONE})
+	defer echo.Release()
+	rangeFinder, err := hcsr04.New(trigger, echo)
+	if err != nil {
+		log.Print("Could not initialize range finder: ", err)
+		return
+	}
+	for {
+		distance, err := rangeFinder.MeasureMedian(context.Background(), RANGE_FINDER_SAMPLES)
+		if err != nil {
+			distance = 0
+		}
+		obstacleMutex.Lock()
+		obstacleDistance = distance
+		obstacleMutex.Unlock()
+		time.Sleep(RANGE_FINDER_PERIOD)
+	}
+}
+
+func runBatteryAlarm() {
+	for {
+		status := upsModule.Status()
+		// the voltage stays 0 until the first reading
+		if status.BatteryVoltage > 0 && status.ChargePercents < BATTERY_LOW_CHARGE {
+			log.Printf("Battery is low: %.0f%%", status.ChargePercents)
+			buzzer.Play(melodyLowBattery, tone.PRIORITY_ALARM)
+			time.Sleep(BATTERY_ALARM_PERIOD)
+			continue
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func obstacle() float64 {
+	obstacleMutex.RLock()
+	defer obstacleMutex.RUnlock()
+	return obstacleDistance
+}
+
+func mode() rc.Mode {
+	modeMutex.RLock()
+	defer modeMutex.RUnlock()
+	return controlMode
+}
+
+func setMode(mode rc.Mode) {
+	modeMutex.Lock()
+	defer modeMutex.Unlock()
+	if mode != controlMode {
+		log.Print("Control mode changed to ", mode)
+		// nobody drives in autonomous mode yet, and the car should not keep going when control changes hands
+		vehicle.Reset()
+	}
+	controlMode = mode
+}
+
+// limitForObstacle prevents driving forward into something close
+func limitForObstacle(vehicleState *vehicle.State) {
+	distance := obstacle()
+	if distance > 0 && distance < OBSTACLE_DISTANCE_MIN &&
+		len(vehicleState.Inputs) == 2 && vehicleState.Inputs[1] > 0 {
+		vehicleState.Inputs[1] = 0
+	}
+}
+
+// runReceiver drives the vehicle from the RC receiver while its mode switch selects manual mode.
+// Without a receiver or once its signal is lost the WebSocket UI drives.
+func runReceiver() {
+	receiver, err := rc.NewReceiver(
+		[]gpio.Alias{RC_STEERING, RC_THROTTLE, RC_MODE},
+		[]rc.Calibration{rc.DefaultCalibration(), rc.DefaultCalibration(), rc.DefaultCalibration()})
+	if err != nil {
+		log.Print("RC receiver is not available: ", err)
+		return
+	}
+	defer receiver.Close()
+	vehicleState := &vehicle.State{Inputs: make([]float64, 2)}
+	for {
+		values, ok := receiver.Values()
+		if !ok {
+			setMode(rc.WEB)
+		} else {
+			setMode(rc.ModeFromValue(values[2]))
+		}
+		if ok && mode() == rc.MANUAL {
+			vehicleState.Inputs[0] = values[0]
+			vehicleState.Inputs[1] = values[1]
+			limitForObstacle(vehicleState)
+			vehicle.UpdateWithState(vehicleState)
+		}
+		time.Sleep(RC_UPDATE_PERIOD)
+	}
+}
+
 func serveVehicleControlWSRequest(w http.ResponseWriter, r *http.Request) {
 	if !wsMutex.TryLock() {
 		log.Print("Websocket multiple connections are not allowed with ", r.Host)
@@ -65,6 +202,7 @@ func serveVehicleControlWSRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	log.Print("Websocket connection established with ", r.Host)
+	buzzer.Play(melodyConnected, tone.PRIORITY_CHIME)
 	defer conn.Close()
 	vehicleState := &vehicle.State{}
 	systemStatus := &SystemStatus{}
@@ -80,7 +218,12 @@ func serveVehicleControlWSRequest(w http.ResponseWriter, r *http.Request) {
 			log.Print("Websocket command format error: ", err)
 			break
 		}
-		vehicle.UpdateWithState(vehicleState)
+		systemStatus.Obstacle = obstacle()
+		systemStatus.Mode = mode()
+		if systemStatus.Mode == rc.WEB {
+			limitForObstacle(vehicleState)
+			vehicle.UpdateWithState(vehicleState)
+		}
 		systemStatus.Battery = upsModule.Status()
 		message, _ = json.Marshal(systemStatus)
 		err = conn.WriteMessage(websocket.TextMessage, message)
@@ -89,20 +232,23 @@ func serveVehicleControlWSRequest(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 	}
-	vehicle.Reset()
+	if mode() == rc.WEB {
+		vehicle.Reset()
+	}
+	buzzer.Play(melodyDisconnected, tone.PRIORITY_CHIME)
 	log.Print("Websocket connection terminated with ", r.Host)
 }
 
 func serveMjpegStreamTcpSocket(strmr *streamer.Streamer[Chunk], address string) {
 	soc, err := net.Listen("tcp", address)
 	if err != nil {
-		log.Fatal("Cannot open socket at ", address, " : ", err)
+		registry.Fatal("Cannot open socket at ", address, " : ", err)
 	}
 	for {
 		log.Print("Waiting for input stream at ", address)
 		conn, err := soc.Accept()
 		if err != nil {
-			log.Fatal("Cannot accept socket connection at ", address, " : ", err)
+			registry.Fatal("Cannot accept socket connection at ", address, " : ", err)
 		}
 		serveMjpegStreamTcpSocketConnection(conn, strmr, address)
 		conn.Close()
@@ -174,11 +320,19 @@ func makeMjpegStreamer(inputAddr string, outputAddr string) *streamer.Streamer[C
 }
 
 func main() {
+	defer registry.ReleaseAll()
+	defer registry.Recover()
+	registry.HandleSignals()
 	upsModule = ups.NewUpsModule3S(i2c.Bus1)
 	go upsModule.Run(time.Second)
 	defer upsModule.Stop()
+	buzzer = tone.NewPlayer(pwm.NewPWM(BUZZER_PWM_BUS, BUZZER_PWM_CHANNEL))
+	defer buzzer.Close()
+	registry.Go(runBatteryAlarm)
+	registry.Go(runRangeFinder)
 
 	vehicle.Initialize()
+	registry.Go(runReceiver)
 	strmr := makeMjpegStreamer(":9990", "/mjpeg_stream")
 	defer strmr.Stop()
 	go gstpipeline.LauchImx219CsiCameraMjpegStream(
@@ -187,6 +341,6 @@ func main() {
 	http.HandleFunc("/ws", serveVehicleControlWSRequest)
 	http.Handle("/", http.FileServer(http.Dir("./public")))
 	if err := http.ListenAndServe(SERVER_ADDRESS, nil); !errors.Is(err, http.ErrServerClosed) {
-		log.Fatal("Unable to start HTTP server: ", err)
+		registry.Fatal("Unable to start HTTP server: ", err)
 	}
 }
@@ -0,0 +1,348 @@
+package encoder
+
+import (
+	"bbai64/gpio"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Mode int
+
+const (
+	X1 Mode = 1 // count rising edges of A
+	X2 Mode = 2 // count both edges of A
+	X4 Mode = 4 // count both edges of A and B
+)
+
+type Channel int
+
+const (
+	ChannelA Channel = 0
+	ChannelB Channel = 1
+)
+
+// VELOCITY_TIMEOUT is how long without ticks it takes to consider the wheel stopped
+const VELOCITY_TIMEOUT = 500 * time.Millisecond
+
+type Status struct {
+	Ticks           int64   `json:"ticks"`
+	Velocity        float64 `json:"velocity"` // ticks per second, negative when going backwards
+	Missed          uint64  `json:"missed"`
+	DirectionErrors uint64  `json:"directionErrors"`
+}
+
+// Decoder turns the edges of A and B into ticks. A leading B counts up.
+// An edge reporting the level its channel already has, or a gap in the sequence numbers,
+// means transitions were missed. If the levels read after that have both changed,
+// the direction can't be known and a direction error is counted instead of a tick.
+type Decoder struct {
+	mode     Mode
+	a, b     gpio.Value
+	seqno    [2]uint32
+	ticks    int64
+	missed   uint64
+	dirErrs  uint64
+	lastTick time.Duration
+	period   time.Duration
+	lastDir  int64
+}
+
+func NewDecoder(mode Mode, a gpio.Value, b gpio.Value) *Decoder {
+	return &Decoder{mode: mode, a: a, b: b}
+}
+
+func (d *Decoder) level(channel Channel) gpio.Value {
+	if channel == ChannelA {
+		return d.a
+	}
+	return d.b
+}
+
+// Update decodes one edge, levels is called to read the actual levels of A and B
+// when the decoder lost track of them
+func (d *Decoder) Update(channel Channel, event gpio.Event, levels func() (gpio.Value, gpio.Value, error)) {
+	value := gpio.LOW
+	if event.Edge == gpio.RISING {
+		value = gpio.HIGH
+	}
+	lost := d.seqno[channel] != 0 && event.Seqno != d.seqno[channel]+1
+	// a sequence number going back, e.g. after the line was requested again, loses track without a count
+	if lost && event.Seqno > d.seqno[channel]+1 {
+		d.missed += uint64(event.Seqno - d.seqno[channel] - 1)
+	}
+	d.seqno[channel] = event.Seqno
+	if value == d.level(channel) {
+		d.missed++
+		lost = true
+	}
+	if lost {
+		if levels != nil {
+			d.resync(levels)
+			return
+		}
+		if value == d.level(channel) {
+			return
+		}
+	}
+
+	var delta int64
+	if channel == ChannelA {
+		// A leads B when A changes to the level B is not at
+		if value != d.b {
+			delta = 1
+		} else {
+			delta = -1
+		}
+		d.a = value
+		if d.mode == X1 && value != gpio.HIGH {
+			delta = 0
+		}
+	} else {
+		// B follows A when B changes to the level A is at
+		if value == d.a {
+			delta = 1
+		} else {
+			delta = -1
+		}
+		d.b = value
+		if d.mode != X4 {
+			delta = 0
+		}
+	}
+	if delta != 0 {
+		d.tick(delta, event.Timestamp)
+	}
+}
+
+func (d *Decoder) resync(levels func() (gpio.Value, gpio.Value, error)) {
+	a, b, err := levels()
+	if err != nil {
+		return
+	}
+	if a != d.a && b != d.b {
+		d.dirErrs++
+	}
+	d.a, d.b = a, b
+}
+
+func (d *Decoder) tick(delta int64, timestamp time.Duration) {
+	d.ticks += delta
+	if d.lastTick != 0 && delta == d.lastDir {
+		d.period = timestamp - d.lastTick
+	} else {
+		d.period = 0
+	}
+	d.lastTick = timestamp
+	d.lastDir = delta
+}
+
+func (d *Decoder) Ticks() int64 {
+	return d.ticks
+}
+
+// Velocity estimates ticks per second at the time now from the period of the last two ticks,
+// it decays once no tick arrived for longer than that period and drops to zero after VELOCITY_TIMEOUT
+func (d *Decoder) Velocity(now time.Duration) float64 {
+	if d.period <= 0 {
+		return 0
+	}
+	elapsed := now - d.lastTick
+	if elapsed > VELOCITY_TIMEOUT {
+		return 0
+	}
+	period := max(d.period, elapsed)
+	return float64(d.lastDir) * float64(time.Second) / float64(period)
+}
+
+func (d *Decoder) Status(now time.Duration) Status {
+	return Status{
+		Ticks:           d.ticks,
+		Velocity:        d.Velocity(now),
+		Missed:          d.missed,
+		DirectionErrors: d.dirErrs,
+	}
+}
+
+func (d *Decoder) Reset() {
+	d.ticks = 0
+	d.missed = 0
+	d.dirErrs = 0
+	d.period = 0
+	d.lastTick = 0
+}
+
+// Encoder decodes a quadrature encoder wired to two gpio inputs
+type Encoder struct {
+	mu      sync.Mutex
+	a, b    *gpio.Pin
+	decoder *Decoder
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// New starts decoding the encoder wired to the pins. The edges are ordered and timed
+// by their kernel timestamps, so the pins must be exported with the cdev backend, see gpio.ActiveBackend.
+func New(a gpio.Alias, b gpio.Alias, mode Mode) (*Encoder, error) {
+	if mode != X1 && mode != X2 && mode != X4 {
+		return nil, fmt.Errorf("unknown encoder mode x%d", mode)
+	}
+	pinA, err := exportInput(a)
+	if err != nil {
+		return nil, err
+	}
+	pinB, err := exportInput(b)
+	if err != nil {
+		pinA.Release()
+		return nil, err
+	}
+	e := &Encoder{a: pinA, b: pinB, done: make(chan struct{})}
+	if pinA.Backend() != gpio.CDEV || pinB.Backend() != gpio.CDEV {
+		e.release()
+		return nil, fmt.Errorf("unable to create encoder: %w", gpio.ErrUserspaceTimestamps)
+	}
+	levelA, levelB, err := e.levels()
+	if err != nil {
+		e.release()
+		return nil, err
+	}
+	e.decoder = NewDecoder(mode, levelA, levelB)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	eventsA, err := pinA.Events(ctx)
+	if err != nil {
+		cancel()
+		e.release()
+		return nil, err
+	}
+	eventsB, err := pinB.Events(ctx)
+	if err != nil {
+		cancel()
+		e.release()
+		return nil, err
+	}
+	go e.run(eventsA, eventsB)
+	return e, nil
+}
+
+func exportInput(alias gpio.Alias) (*gpio.Pin, error) {
+	pin, err := gpio.Export(alias)
+	if err != nil {
+		return nil, err
+	}
+	pin.SetSafeState(gpio.SafeState{Direction: gpio.IN, Edge: gpio.NONE})
+	if err := pin.SetDirection(gpio.IN); err != nil {
+		pin.Release()
+		return nil, err
+	}
+	if err := pin.SetEdge(gpio.BOTH); err != nil {
+		pin.Release()
+		return nil, err
+	}
+	return pin, nil
+}
+
+func (e *Encoder) levels() (gpio.Value, gpio.Value, error) {
+	a, err := e.a.Value()
+	if err != nil {
+		return gpio.LOW, gpio.LOW, err
+	}
+	b, err := e.b.Value()
+	return a, b, err
+}
+
+type channelEvent struct {
+	channel Channel
+	event   gpio.Event
+}
+
+// run merges the edges of both channels in timestamp order,
+// as the edges of one channel may be delivered before earlier edges of the other
+func (e *Encoder) run(eventsA <-chan gpio.Event, eventsB <-chan gpio.Event) {
+	defer close(e.done)
+	batch := []channelEvent{}
+	for eventsA != nil || eventsB != nil {
+		batch = batch[:0]
+		select {
+		case event, ok := <-eventsA:
+			if !ok {
+				eventsA = nil
+				continue
+			}
+			batch = append(batch, channelEvent{ChannelA, event})
+		case event, ok := <-eventsB:
+			if !ok {
+				eventsB = nil
+				continue
+			}
+			batch = append(batch, channelEvent{ChannelB, event})
+		}
+	drain:
+		for {
+			select {
+			case event, ok := <-eventsA:
+				if !ok {
+					eventsA = nil
+					break drain
+				}
+				batch = append(batch, channelEvent{ChannelA, event})
+			case event, ok := <-eventsB:
+				if !ok {
+					eventsB = nil
+					break drain
+				}
+				batch = append(batch, channelEvent{ChannelB, event})
+			default:
+				break drain
+			}
+		}
+		sort.SliceStable(batch, func(i, j int) bool {
+			return batch[i].event.Timestamp < batch[j].event.Timestamp
+		})
+		e.mu.Lock()
+		for _, item := range batch {
+			e.decoder.Update(item.channel, item.event, e.levels)
+		}
+		e.mu.Unlock()
+	}
+}
+
+func (e *Encoder) Ticks() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.decoder.Ticks()
+}
+
+// Velocity returns ticks per second, negative when going backwards
+func (e *Encoder) Velocity() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.decoder.Velocity(gpio.Now())
+}
+
+func (e *Encoder) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.decoder.Status(gpio.Now())
+}
+
+func (e *Encoder) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.decoder.Reset()
+}
+
+func (e *Encoder) release() {
+	e.a.Release()
+	e.b.Release()
+}
+
+// Close stops decoding and releases both pins
+func (e *Encoder) Close() {
+	e.cancel()
+	<-e.done
+	e.release()
+}
@@ -0,0 +1,130 @@
+package encoder
+
+import (
+	"bbai64/gpio"
+	"bbai64/hwtest"
+	"bbai64/sysfs"
+	"errors"
+	"testing"
+	"time"
+)
+
+type edge struct {
+	channel Channel
+	edge    gpio.Edge
+}
+
+var forward = []edge{{ChannelA, gpio.RISING}, {ChannelB, gpio.RISING}, {ChannelA, gpio.FALLING}, {ChannelB, gpio.FALLING}}
+var backward = []edge{{ChannelB, gpio.RISING}, {ChannelA, gpio.RISING}, {ChannelB, gpio.FALLING}, {ChannelA, gpio.FALLING}}
+
+func feed(d *Decoder, edges []edge, start time.Duration, step time.Duration) time.Duration {
+	seqno := [2]uint32{}
+	for i, e := range edges {
+		seqno[e.channel] = d.seqno[e.channel] + 1
+		d.Update(e.channel, gpio.Event{Edge: e.edge, Timestamp: start + time.Duration(i)*step, Seqno: seqno[e.channel]}, nil)
+	}
+	return start + time.Duration(len(edges))*step
+}
+
+func TestDecoderModes(t *testing.T) {
+	for mode, ticks := range map[Mode]int64{X1: 2, X2: 4, X4: 8} {
+		d := NewDecoder(mode, gpio.LOW, gpio.LOW)
+		now := feed(d, append(forward, forward...), time.Second, time.Millisecond)
+		if d.Ticks() != ticks {
+			t.Errorf("x%d: expected %d ticks forward, got %d", mode, ticks, d.Ticks())
+		}
+		if v := d.Velocity(now); v <= 0 {
+			t.Errorf("x%d: expected positive velocity, got %f", mode, v)
+		}
+		now = feed(d, append(backward, backward...), now, time.Millisecond)
+		if d.Ticks() != 0 {
+			t.Errorf("x%d: expected to be back at 0, got %d", mode, d.Ticks())
+		}
+		if v := d.Velocity(now); v >= 0 {
+			t.Errorf("x%d: expected negative velocity, got %f", mode, v)
+		}
+		if v := d.Velocity(now + VELOCITY_TIMEOUT + time.Millisecond); v != 0 {
+			t.Errorf("x%d: expected velocity to time out, got %f", mode, v)
+		}
+	}
+}
+
+func TestDecoderVelocity(t *testing.T) {
+	d := NewDecoder(X4, gpio.LOW, gpio.LOW)
+	now := feed(d, forward, 0, 10*time.Millisecond)
+	if v := d.Velocity(now - 10*time.Millisecond); v != 100 {
+		t.Errorf("expected 100 ticks/s, got %f", v)
+	}
+	if v := d.Velocity(now + 10*time.Millisecond); v != 50 {
+		t.Errorf("expected velocity to decay to 50 ticks/s, got %f", v)
+	}
+}
+
+func TestDecoderMissedTransitions(t *testing.T) {
+	d := NewDecoder(X4, gpio.LOW, gpio.LOW)
+	d.Update(ChannelA, gpio.Event{Edge: gpio.RISING, Seqno: 1}, nil)
+	d.Update(ChannelA, gpio.Event{Edge: gpio.RISING, Seqno: 2}, func() (gpio.Value, gpio.Value, error) {
+		return gpio.HIGH, gpio.LOW, nil
+	})
+	d.Update(ChannelA, gpio.Event{Edge: gpio.FALLING, Seqno: 5}, func() (gpio.Value, gpio.Value, error) {
+		return gpio.LOW, gpio.HIGH, nil
+	})
+	status := d.Status(0)
+	if status.Ticks != 1 || status.Missed != 3 || status.DirectionErrors != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestDecoderSeqnoRestart(t *testing.T) {
+	d := NewDecoder(X4, gpio.LOW, gpio.LOW)
+	d.Update(ChannelA, gpio.Event{Edge: gpio.RISING, Seqno: 7}, nil)
+	d.Update(ChannelA, gpio.Event{Edge: gpio.FALLING, Seqno: 1}, func() (gpio.Value, gpio.Value, error) {
+		return gpio.LOW, gpio.LOW, nil
+	})
+	if status := d.Status(0); status.Missed != 0 || status.Ticks != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestNewRequiresCdev(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddGPIOChip("gpiochip1", "600000.gpio", 425, "", string(gpio.P8_03), string(gpio.P8_04))
+	gpio.SetBackend(gpio.SYSFS)
+	gpio.SetFS(tree)
+	t.Cleanup(func() {
+		gpio.SetBackend("")
+		gpio.SetFS(sysfs.Host)
+	})
+	if _, err := New(gpio.P8_03, gpio.P8_04, X4); !errors.Is(err, gpio.ErrUserspaceTimestamps) {
+		t.Errorf("expected the sysfs pins to be rejected, got %v", err)
+	}
+	if tree.Exists("/sys/class/gpio/gpio426") || tree.Exists("/sys/class/gpio/gpio427") {
+		t.Error("expected the pins to be released")
+	}
+}
+
+// the edges of both channels are decoded in timestamp order, whatever channel delivers them first
+func TestEncoderMergesChannels(t *testing.T) {
+	e := &Encoder{decoder: NewDecoder(X4, gpio.LOW, gpio.LOW), done: make(chan struct{})}
+	eventsA := make(chan gpio.Event, 4)
+	eventsB := make(chan gpio.Event, 4)
+	eventsB <- gpio.Event{Edge: gpio.RISING, Timestamp: 2 * time.Millisecond, Seqno: 1}
+	eventsB <- gpio.Event{Edge: gpio.FALLING, Timestamp: 4 * time.Millisecond, Seqno: 2}
+	eventsA <- gpio.Event{Edge: gpio.RISING, Timestamp: 1 * time.Millisecond, Seqno: 1}
+	eventsA <- gpio.Event{Edge: gpio.FALLING, Timestamp: 3 * time.Millisecond, Seqno: 2}
+	go e.run(eventsA, eventsB)
+	deadline := time.Now().Add(time.Second)
+	for e.Ticks() != 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if status := e.Status(); status.Ticks != 4 || status.Missed != 0 || status.DirectionErrors != 0 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	close(eventsA)
+	close(eventsB)
+	select {
+	case <-e.done:
+	case <-time.After(time.Second):
+		t.Fatal("run did not return after the streams were closed")
+	}
+}
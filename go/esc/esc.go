@@ -0,0 +1,232 @@
+package esc
+
+import (
+	"bbai64/pwm"
+	"bbai64/servo"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Mode string
+
+const (
+	FORWARD_ONLY          Mode = "forward-only"          // reverse input is ignored
+	FORWARD_BRAKE         Mode = "forward-brake"         // reverse input brakes
+	FORWARD_BRAKE_REVERSE Mode = "forward-brake-reverse" // reverse input brakes, then reverses after a neutral
+)
+
+const ARMING_TIME_DEFAULT = 3 * time.Second
+const DEADBAND_DEFAULT = 0.05
+const BRAKE_TIME_DEFAULT = 200 * time.Millisecond
+const NEUTRAL_TIME_DEFAULT = 100 * time.Millisecond
+
+type Config struct {
+	Mode            Mode          `json:"mode"`
+	ArmingTime      time.Duration `json:"armingTime"`      // neutral held at start, until the ESC beeps ready
+	ForwardDeadband float64       `json:"forwardDeadband"` // inputs in (0, ForwardDeadband) are neutral
+	ReverseDeadband float64       `json:"reverseDeadband"` // inputs in (-ReverseDeadband, 0) are neutral
+	BrakeTime       time.Duration `json:"brakeTime"`       // brake pulse held before going to reverse
+	NeutralTime     time.Duration `json:"neutralTime"`     // neutral pulse held between brake and reverse
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Mode:            FORWARD_BRAKE_REVERSE,
+		ArmingTime:      ARMING_TIME_DEFAULT,
+		ForwardDeadband: DEADBAND_DEFAULT,
+		ReverseDeadband: DEADBAND_DEFAULT,
+		BrakeTime:       BRAKE_TIME_DEFAULT,
+		NeutralTime:     NEUTRAL_TIME_DEFAULT,
+	}
+}
+
+func (c Config) Validate() error {
+	switch c.Mode {
+	case FORWARD_ONLY, FORWARD_BRAKE, FORWARD_BRAKE_REVERSE:
+	default:
+		return fmt.Errorf("unknown esc mode %q", c.Mode)
+	}
+	if c.ForwardDeadband < 0 || c.ForwardDeadband >= 1 || c.ReverseDeadband < 0 || c.ReverseDeadband >= 1 {
+		return fmt.Errorf("esc deadbands %f and %f must be in [0, 1)", c.ForwardDeadband, c.ReverseDeadband)
+	}
+	if c.ArmingTime < 0 || c.BrakeTime < 0 || c.NeutralTime < 0 {
+		return fmt.Errorf("esc times must not be negative")
+	}
+	return nil
+}
+
+type sequence int
+
+const (
+	sequenceNone sequence = iota
+	sequenceBrake
+	sequenceNeutral
+)
+
+// ESC drives a hobby electronic speed controller through the throttle servo signal.
+// Negative outputs are brakes until the ESC saw a neutral after braking, only then they are reverse,
+// so in FORWARD_BRAKE_REVERSE mode going from forward to reverse plays brake, neutral, reverse.
+type ESC struct {
+	mu           sync.Mutex
+	servo        *servo.Servo
+	config       Config
+	armed        bool
+	requested    float64
+	output       float64
+	braked       bool // the last non neutral output was a brake
+	reverseReady bool // a negative output is reverse
+	sequence     sequence
+	generation   int // tells the timer of a cancelled sequence apart
+	timer        *time.Timer
+}
+
+// New outputs neutral right away and arms after the arming time
+func New(p *pwm.PWM, calibration servo.Calibration, config Config) (*ESC, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	s, err := servo.New(p, calibration)
+	if err != nil {
+		return nil, err
+	}
+	e := &ESC{servo: s, config: config, reverseReady: true}
+	if config.ArmingTime == 0 {
+		e.armed = true
+	} else {
+		time.AfterFunc(config.ArmingTime, e.arm)
+	}
+	return e, nil
+}
+
+func (e *ESC) arm() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.armed = true
+	e.update()
+}
+
+func (e *ESC) Armed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.armed
+}
+
+// Set requests a throttle in [-1, 1], negative values brake or reverse depending on the mode
+func (e *ESC) Set(throttle float64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requested = e.shape(throttle)
+	return e.update()
+}
+
+// Neutral stops driving at once, cancelling a brake to reverse sequence
+func (e *ESC) Neutral() error {
+	return e.Set(0)
+}
+
+// Output returns the throttle sent to the ESC, which lags the requested one during a brake to reverse sequence
+func (e *ESC) Output() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.output
+}
+
+// shape applies the deadbands, rescaling the rest of each side to the full range
+func (e *ESC) shape(throttle float64) float64 {
+	throttle = min(max(throttle, -1), 1)
+	switch {
+	case throttle > 0:
+		if throttle < e.config.ForwardDeadband {
+			return 0
+		}
+		return (throttle - e.config.ForwardDeadband) / (1 - e.config.ForwardDeadband)
+	case throttle < 0:
+		if e.config.Mode == FORWARD_ONLY || -throttle < e.config.ReverseDeadband {
+			return 0
+		}
+		return (throttle + e.config.ReverseDeadband) / (1 - e.config.ReverseDeadband)
+	}
+	return 0
+}
+
+// update must be called with the lock held
+func (e *ESC) update() error {
+	if !e.armed {
+		return e.write(0)
+	}
+	throttle := e.requested
+	if throttle >= 0 || e.config.Mode != FORWARD_BRAKE_REVERSE || e.reverseReady {
+		e.cancel()
+		return e.write(throttle)
+	}
+	if e.sequence != sequenceNone {
+		// the running sequence picks up the requested throttle once it reaches reverse
+		return nil
+	}
+	e.sequence = sequenceBrake
+	e.schedule(e.config.BrakeTime)
+	return e.write(throttle)
+}
+
+func (e *ESC) schedule(delay time.Duration) {
+	generation := e.generation
+	e.timer = time.AfterFunc(delay, func() {
+		e.advance(generation)
+	})
+}
+
+func (e *ESC) advance(generation int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if generation != e.generation {
+		return
+	}
+	switch e.sequence {
+	case sequenceBrake:
+		e.sequence = sequenceNeutral
+		e.schedule(e.config.NeutralTime)
+		e.write(0)
+	case sequenceNeutral:
+		e.sequence = sequenceNone
+		e.timer = nil
+		e.write(e.requested)
+	}
+}
+
+func (e *ESC) cancel() {
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	e.generation++
+	e.sequence = sequenceNone
+}
+
+// write tracks what the ESC makes of the outputs, it must be called with the lock held
+func (e *ESC) write(throttle float64) error {
+	switch {
+	case throttle > 0:
+		e.braked = false
+		e.reverseReady = false
+	case throttle < 0 && !e.reverseReady:
+		e.braked = true
+	case throttle == 0 && e.braked:
+		e.braked = false
+		e.reverseReady = true
+	}
+	e.output = throttle
+	return e.servo.SetNow(throttle)
+}
+
+func (e *ESC) SetCalibration(calibration servo.Calibration) error {
+	return e.servo.SetCalibration(calibration)
+}
+
+// Disable stops the pulses, most ESCs then cut the motor and beep
+func (e *ESC) Disable() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cancel()
+	return e.servo.Disable()
+}
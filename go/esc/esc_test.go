@@ -0,0 +1,104 @@
+package esc
+
+import (
+	"bbai64/hwtest"
+	"bbai64/pwm"
+	"bbai64/servo"
+	"bbai64/sysfs"
+	"testing"
+	"time"
+)
+
+func newTestESC(t *testing.T, config Config) (*ESC, *hwtest.Tree) {
+	tree := hwtest.NewTree(t)
+	tree.AddBonePWM(0, "b")
+	pwm.SetFS(tree)
+	t.Cleanup(func() { pwm.SetFS(sysfs.Host) })
+	p := pwm.NewPWM(pwm.Bus0, pwm.ChannelB)
+	t.Cleanup(func() { p.Release() })
+	e, err := New(p, servo.DefaultCalibration(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, tree
+}
+
+func TestArming(t *testing.T) {
+	config := DefaultConfig()
+	config.ArmingTime = 50 * time.Millisecond
+	e, _ := newTestESC(t, config)
+	e.Set(0.5)
+	if e.Armed() || e.Output() != 0 {
+		t.Errorf("expected neutral while arming, got %f", e.Output())
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !e.Armed() || e.Output() <= 0 {
+		t.Errorf("expected the requested throttle once armed, got %f", e.Output())
+	}
+}
+
+func TestDeadbands(t *testing.T) {
+	config := DefaultConfig()
+	config.ArmingTime = 0
+	config.ForwardDeadband = 0.1
+	config.ReverseDeadband = 0.2
+	e, _ := newTestESC(t, config)
+	cases := map[float64]float64{0.05: 0, 0.1: 0, 1: 1, 0.55: 0.5, -0.1: 0, -0.6: -0.5, -1: -1}
+	for input, shaped := range cases {
+		if value := e.shape(input); value < shaped-1e-9 || value > shaped+1e-9 {
+			t.Errorf("expected %f for %f, got %f", shaped, input, value)
+		}
+	}
+}
+
+func TestModes(t *testing.T) {
+	config := DefaultConfig()
+	config.ArmingTime = 0
+	config.Mode = FORWARD_ONLY
+	e, _ := newTestESC(t, config)
+	if e.Set(-1); e.Output() != 0 {
+		t.Errorf("expected reverse to be ignored, got %f", e.Output())
+	}
+
+	config.Mode = FORWARD_BRAKE
+	e, _ = newTestESC(t, config)
+	e.Set(1)
+	if e.Set(-1); e.Output() != -1 {
+		t.Errorf("expected to brake at once, got %f", e.Output())
+	}
+}
+
+func TestBrakeToReverse(t *testing.T) {
+	config := DefaultConfig()
+	config.ArmingTime = 0
+	config.BrakeTime = 30 * time.Millisecond
+	config.NeutralTime = 30 * time.Millisecond
+	e, tree := newTestESC(t, config)
+
+	if e.Set(-1); e.Output() != -1 {
+		t.Errorf("expected reverse right after arming, got %f", e.Output())
+	}
+	e.Set(1)
+	tree.ResetWrites()
+	e.Set(-1)
+	time.Sleep(100 * time.Millisecond)
+	pulses := tree.WritesTo("/dev/bone/pwm/0/b/duty_cycle")
+	expected := []string{"1180000", "1500000", "1180000"}
+	if len(pulses) != len(expected) {
+		t.Fatalf("expected brake, neutral, reverse, got %v", pulses)
+	}
+	for i := range expected {
+		if pulses[i] != expected[i] {
+			t.Errorf("expected brake, neutral, reverse, got %v", pulses)
+		}
+	}
+
+	// going forward in the middle of a sequence cancels it
+	e.Set(1)
+	e.Set(-1)
+	e.Set(1)
+	time.Sleep(100 * time.Millisecond)
+	if e.Output() != 1 {
+		t.Errorf("expected forward to cancel the sequence, got %f", e.Output())
+	}
+}
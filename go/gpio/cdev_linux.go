@@ -0,0 +1,619 @@
+//go:build linux
+// +build linux
+
+package gpio
+
+// based on: https://www.kernel.org/doc/html/latest/userspace-api/gpio/chardev.html (linux/gpio.h, uAPI v2)
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	GPIO_MAX_NAME_SIZE         = 32
+	GPIO_V2_LINES_MAX          = 64
+	GPIO_V2_LINE_NUM_ATTRS_MAX = 10
+
+	GPIO_GET_CHIPINFO_IOCTL       = 0x8044B401
+	GPIO_V2_GET_LINEINFO_IOCTL    = 0xC100B405
+	GPIO_V2_GET_LINE_IOCTL        = 0xC250B407
+	GPIO_V2_LINE_SET_CONFIG_IOCTL = 0xC110B40D
+	GPIO_V2_LINE_GET_VALUES_IOCTL = 0xC010B40E
+	GPIO_V2_LINE_SET_VALUES_IOCTL = 0xC010B40F
+)
+
+const (
+	GPIO_V2_LINE_FLAG_USED uint64 = 1 << iota
+	GPIO_V2_LINE_FLAG_ACTIVE_LOW
+	GPIO_V2_LINE_FLAG_INPUT
+	GPIO_V2_LINE_FLAG_OUTPUT
+	GPIO_V2_LINE_FLAG_EDGE_RISING
+	GPIO_V2_LINE_FLAG_EDGE_FALLING
+	GPIO_V2_LINE_FLAG_OPEN_DRAIN
+	GPIO_V2_LINE_FLAG_OPEN_SOURCE
+	GPIO_V2_LINE_FLAG_BIAS_PULL_UP
+	GPIO_V2_LINE_FLAG_BIAS_PULL_DOWN
+	GPIO_V2_LINE_FLAG_BIAS_DISABLED
+	GPIO_V2_LINE_FLAG_EVENT_CLOCK_REALTIME
+	GPIO_V2_LINE_FLAG_EVENT_CLOCK_HTE
+)
+
+const (
+	GPIO_V2_LINE_ATTR_ID_FLAGS         = 1
+	GPIO_V2_LINE_ATTR_ID_OUTPUT_VALUES = 2
+	GPIO_V2_LINE_ATTR_ID_DEBOUNCE      = 3
+)
+
+const (
+	GPIO_V2_LINE_EVENT_RISING_EDGE  = 1
+	GPIO_V2_LINE_EVENT_FALLING_EDGE = 2
+)
+
+const CDEV_CONSUMER = "bbai64"
+
+const gpioV2LineDirectionFlags = GPIO_V2_LINE_FLAG_INPUT | GPIO_V2_LINE_FLAG_OUTPUT
+const gpioV2LineEdgeFlags = GPIO_V2_LINE_FLAG_EDGE_RISING | GPIO_V2_LINE_FLAG_EDGE_FALLING
+const gpioV2LineDriveFlags = GPIO_V2_LINE_FLAG_OPEN_DRAIN | GPIO_V2_LINE_FLAG_OPEN_SOURCE
+const gpioV2LineBiasFlags = GPIO_V2_LINE_FLAG_BIAS_PULL_UP | GPIO_V2_LINE_FLAG_BIAS_PULL_DOWN | GPIO_V2_LINE_FLAG_BIAS_DISABLED
+
+// ENOTSUPP is the kernel internal errno the pinctrl drivers return for unsupported bias or drive
+const ENOTSUPP = syscall.Errno(524)
+
+type gpioChipInfo struct {
+	name  [GPIO_MAX_NAME_SIZE]byte
+	label [GPIO_MAX_NAME_SIZE]byte
+	lines uint32
+}
+
+type gpioV2LineAttribute struct {
+	id      uint32
+	padding uint32
+	value   uint64 // flags, values or debounce_period_us depending on id
+}
+
+type gpioV2LineConfigAttribute struct {
+	attr gpioV2LineAttribute
+	mask uint64
+}
+
+type gpioV2LineConfig struct {
+	flags    uint64
+	numAttrs uint32
+	padding  [5]uint32
+	attrs    [GPIO_V2_LINE_NUM_ATTRS_MAX]gpioV2LineConfigAttribute
+}
+
+type gpioV2LineRequest struct {
+	offsets         [GPIO_V2_LINES_MAX]uint32
+	consumer        [GPIO_MAX_NAME_SIZE]byte
+	config          gpioV2LineConfig
+	numLines        uint32
+	eventBufferSize uint32
+	padding         [5]uint32
+	fd              int32
+}
+
+type gpioV2LineValues struct {
+	bits uint64
+	mask uint64
+}
+
+type gpioV2LineInfo struct {
+	name     [GPIO_MAX_NAME_SIZE]byte
+	consumer [GPIO_MAX_NAME_SIZE]byte
+	offset   uint32
+	numAttrs uint32
+	flags    uint64
+	attrs    [GPIO_V2_LINE_NUM_ATTRS_MAX]gpioV2LineAttribute
+	padding  [4]uint32
+}
+
+type gpioV2LineEvent struct {
+	timestampNs uint64
+	id          uint32
+	offset      uint32
+	seqno       uint32
+	lineSeqno   uint32
+	padding     [6]uint32
+}
+
+func ioctl(fd uintptr, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func chipInfo(chip *os.File) (gpioChipInfo, error) {
+	info := gpioChipInfo{}
+	err := ioctl(chip.Fd(), GPIO_GET_CHIPINFO_IOCTL, unsafe.Pointer(&info))
+	return info, err
+}
+
+func lineInfo(chip *os.File, offset uint32) (gpioV2LineInfo, error) {
+	info := gpioV2LineInfo{offset: offset}
+	err := ioctl(chip.Fd(), GPIO_V2_GET_LINEINFO_IOCTL, unsafe.Pointer(&info))
+	return info, err
+}
+
+// cdevLines is a line request holding one or more lines of a single gpiochip
+type cdevLines struct {
+	chip    *os.File
+	fd      int
+	offsets []uint32
+	flags   uint64
+}
+
+func requestLines(chipPath string, offsets []uint32, flags uint64, values uint64) (*cdevLines, error) {
+	if len(offsets) == 0 || len(offsets) > GPIO_V2_LINES_MAX {
+		return nil, fmt.Errorf("invalid number of lines %d", len(offsets))
+	}
+	chip, err := os.OpenFile(chipPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	req := gpioV2LineRequest{numLines: uint32(len(offsets))}
+	copy(req.offsets[:], offsets)
+	copy(req.consumer[:GPIO_MAX_NAME_SIZE-1], CDEV_CONSUMER)
+	req.config = lineConfig(flags, values, len(offsets))
+	if err := ioctl(chip.Fd(), GPIO_V2_GET_LINE_IOCTL, unsafe.Pointer(&req)); err != nil {
+		chip.Close()
+		return nil, err
+	}
+	// events are read only once poll() reports them, or drained until EAGAIN
+	if err := syscall.SetNonblock(int(req.fd), true); err != nil {
+		syscall.Close(int(req.fd))
+		chip.Close()
+		return nil, err
+	}
+	return &cdevLines{
+		chip:    chip,
+		fd:      int(req.fd),
+		offsets: append([]uint32(nil), offsets...),
+		flags:   flags,
+	}, nil
+}
+
+func lineConfig(flags uint64, values uint64, n int) gpioV2LineConfig {
+	config := gpioV2LineConfig{flags: flags}
+	if flags&GPIO_V2_LINE_FLAG_OUTPUT != 0 {
+		config.attrs[0] = gpioV2LineConfigAttribute{
+			attr: gpioV2LineAttribute{id: GPIO_V2_LINE_ATTR_ID_OUTPUT_VALUES, value: values},
+			mask: lineMask(n),
+		}
+		config.numAttrs = 1
+	}
+	return config
+}
+
+func (l *cdevLines) setConfig(flags uint64, values uint64) error {
+	config := lineConfig(flags, values, len(l.offsets))
+	if err := ioctl(uintptr(l.fd), GPIO_V2_LINE_SET_CONFIG_IOCTL, unsafe.Pointer(&config)); err != nil {
+		return err
+	}
+	l.flags = flags
+	return nil
+}
+
+func (l *cdevLines) values(mask uint64) (uint64, error) {
+	values := gpioV2LineValues{mask: mask}
+	err := ioctl(uintptr(l.fd), GPIO_V2_LINE_GET_VALUES_IOCTL, unsafe.Pointer(&values))
+	return values.bits, err
+}
+
+func (l *cdevLines) setValues(bits uint64, mask uint64) error {
+	values := gpioV2LineValues{bits: bits, mask: mask}
+	return ioctl(uintptr(l.fd), GPIO_V2_LINE_SET_VALUES_IOCTL, unsafe.Pointer(&values))
+}
+
+func (l *cdevLines) info(index int) (gpioV2LineInfo, error) {
+	return lineInfo(l.chip, l.offsets[index])
+}
+
+// readEvents reads all pending edge events, without blocking
+func (l *cdevLines) readEvents(events []gpioV2LineEvent) ([]gpioV2LineEvent, error) {
+	buff := make([]gpioV2LineEvent, 16)
+	size := int(unsafe.Sizeof(buff[0]))
+	for {
+		raw := unsafe.Slice((*byte)(unsafe.Pointer(&buff[0])), len(buff)*size)
+		n, err := syscall.Read(l.fd, raw)
+		if err == syscall.EAGAIN {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		events = append(events, buff[:n/size]...)
+		if n < len(raw) {
+			return events, nil
+		}
+	}
+}
+
+func (l *cdevLines) close() error {
+	err := syscall.Close(l.fd)
+	l.chip.Close()
+	return err
+}
+
+// cdevDriver drives a single line request through the Pin API
+type cdevDriver struct {
+	lines *cdevLines
+	drive Drive // applied whenever the line is an output
+}
+
+func (d *cdevDriver) value() (Value, error) {
+	bits, err := d.lines.values(1)
+	if err != nil {
+		return LOW, err
+	}
+	return Value(bits & 1), nil
+}
+
+func (d *cdevDriver) setValue(value Value) error {
+	return d.lines.setValues(uint64(value)&1, 1)
+}
+
+func (d *cdevDriver) direction() (Direction, error) {
+	info, err := d.lines.info(0)
+	if err != nil {
+		return IN, err
+	}
+	if info.flags&GPIO_V2_LINE_FLAG_OUTPUT != 0 {
+		return OUT, nil
+	}
+	return IN, nil
+}
+
+func (d *cdevDriver) setDirection(direction Direction) error {
+	flags, err := withDirection(d.lines.flags, direction)
+	if err != nil {
+		return err
+	}
+	if direction == OUT {
+		flags |= driveFlags(d.drive)
+	}
+	return unsupported(d.lines.setConfig(flags, 0))
+}
+
+func (d *cdevDriver) edge() (Edge, error) {
+	info, err := d.lines.info(0)
+	if err != nil {
+		return NONE, err
+	}
+	return edgeFromFlags(info.flags), nil
+}
+
+func (d *cdevDriver) setEdge(edge Edge) error {
+	flags := d.lines.flags &^ (gpioV2LineDirectionFlags | gpioV2LineEdgeFlags | gpioV2LineDriveFlags)
+	switch edge {
+	case NONE:
+		flags |= d.lines.flags & (gpioV2LineDirectionFlags | gpioV2LineDriveFlags)
+	case RISING:
+		flags |= GPIO_V2_LINE_FLAG_INPUT | GPIO_V2_LINE_FLAG_EDGE_RISING
+	case FALLING:
+		flags |= GPIO_V2_LINE_FLAG_INPUT | GPIO_V2_LINE_FLAG_EDGE_FALLING
+	case BOTH:
+		flags |= GPIO_V2_LINE_FLAG_INPUT | gpioV2LineEdgeFlags
+	default:
+		return fmt.Errorf("unknown edge %q", edge)
+	}
+	return d.lines.setConfig(flags, 0)
+}
+
+func (d *cdevDriver) setBias(bias Bias) error {
+	flags := d.lines.flags &^ gpioV2LineBiasFlags
+	switch bias {
+	case DISABLED:
+		flags |= GPIO_V2_LINE_FLAG_BIAS_DISABLED
+	case PULL_UP:
+		flags |= GPIO_V2_LINE_FLAG_BIAS_PULL_UP
+	case PULL_DOWN:
+		flags |= GPIO_V2_LINE_FLAG_BIAS_PULL_DOWN
+	}
+	// the kernel only accepts a bias along with a direction
+	if flags&gpioV2LineBiasFlags != 0 && flags&gpioV2LineDirectionFlags == 0 {
+		direction, err := d.direction()
+		if err != nil {
+			return err
+		}
+		if flags, err = withDirection(flags, direction); err != nil {
+			return err
+		}
+	}
+	return d.reconfigure(flags, false)
+}
+
+func (d *cdevDriver) setDrive(drive Drive) error {
+	if d.lines.flags&GPIO_V2_LINE_FLAG_OUTPUT != 0 {
+		flags := d.lines.flags&^gpioV2LineDriveFlags | driveFlags(drive)
+		if err := d.reconfigure(flags, false); err != nil {
+			return err
+		}
+	}
+	d.drive = drive
+	return nil
+}
+
+func (d *cdevDriver) setActiveLow(activeLow bool) error {
+	flags := d.lines.flags &^ GPIO_V2_LINE_FLAG_ACTIVE_LOW
+	if activeLow {
+		flags |= GPIO_V2_LINE_FLAG_ACTIVE_LOW
+	}
+	return d.reconfigure(flags, flags != d.lines.flags)
+}
+
+// reconfigure applies new flags keeping the physical level of an output,
+// invert tells that the logical value flips because active low changes
+func (d *cdevDriver) reconfigure(flags uint64, invert bool) error {
+	var values uint64
+	if flags&GPIO_V2_LINE_FLAG_OUTPUT != 0 && d.lines.flags&GPIO_V2_LINE_FLAG_OUTPUT != 0 {
+		bits, err := d.lines.values(1)
+		if err != nil {
+			return err
+		}
+		values = bits
+		if invert {
+			values ^= 1
+		}
+	}
+	return unsupported(d.lines.setConfig(flags, values))
+}
+
+func driveFlags(drive Drive) uint64 {
+	switch drive {
+	case OPEN_DRAIN:
+		return GPIO_V2_LINE_FLAG_OPEN_DRAIN
+	case OPEN_SOURCE:
+		return GPIO_V2_LINE_FLAG_OPEN_SOURCE
+	}
+	return 0
+}
+
+// unsupported tells apart the configurations the line can't do from the other failures
+func unsupported(err error) error {
+	if err == syscall.EOPNOTSUPP || err == ENOTSUPP {
+		return fmt.Errorf("%w by the line: %w", ErrUnsupported, err)
+	}
+	return err
+}
+
+func (d *cdevDriver) watchFd() (int, bool) {
+	return d.lines.fd, false
+}
+
+// arm drops the edges queued before anyone was watching
+func (d *cdevDriver) arm() error {
+	_, err := d.lines.readEvents(nil)
+	return err
+}
+
+func (d *cdevDriver) readEvents(events []Event) ([]Event, error) {
+	lineEvents, err := d.lines.readEvents(nil)
+	for _, event := range lineEvents {
+		events = append(events, eventFromLineEvent(event))
+	}
+	return events, err
+}
+
+func (d *cdevDriver) close() error {
+	return d.lines.close()
+}
+
+// withDirection replaces the direction flags, edge detection is only kept for inputs
+// and open drain or source only for outputs
+func withDirection(flags uint64, direction Direction) (uint64, error) {
+	flags &^= gpioV2LineDirectionFlags
+	switch direction {
+	case IN:
+		return flags&^gpioV2LineDriveFlags | GPIO_V2_LINE_FLAG_INPUT, nil
+	case OUT:
+		return flags&^gpioV2LineEdgeFlags | GPIO_V2_LINE_FLAG_OUTPUT, nil
+	}
+	return flags, fmt.Errorf("unknown direction %q", direction)
+}
+
+func eventFromLineEvent(event gpioV2LineEvent) Event {
+	edge := RISING
+	if event.id == GPIO_V2_LINE_EVENT_FALLING_EDGE {
+		edge = FALLING
+	}
+	return Event{
+		Edge:      edge,
+		Timestamp: time.Duration(event.timestampNs),
+		Seqno:     event.lineSeqno,
+	}
+}
+
+func edgeFromFlags(flags uint64) Edge {
+	switch flags & gpioV2LineEdgeFlags {
+	case GPIO_V2_LINE_FLAG_EDGE_RISING:
+		return RISING
+	case GPIO_V2_LINE_FLAG_EDGE_FALLING:
+		return FALLING
+	case gpioV2LineEdgeFlags:
+		return BOTH
+	}
+	return NONE
+}
+
+// readChipLines reads the chip label and all line names through the gpiochip info ioctls
+func readChipLines(path string) (string, []string, error) {
+	chip, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer chip.Close()
+	info, err := chipInfo(chip)
+	if err != nil {
+		return "", nil, err
+	}
+	names := make([]string, info.lines)
+	for offset := range names {
+		line, err := lineInfo(chip, uint32(offset))
+		if err != nil {
+			return "", nil, err
+		}
+		names[offset] = cString(line.name[:])
+	}
+	return cString(info.label[:]), names, nil
+}
+
+func exportCdev(alias Alias) (*Pin, error) {
+	line, err := DefaultResolver.Resolve(alias)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find gpio line %s: %w", alias, err)
+	}
+	chipPath := filepath.Join(DefaultResolver.Root(), "dev", line.Chip)
+	lines, err := requestLines(chipPath, []uint32{uint32(line.Offset)}, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to request gpio line %s: %w", alias, err)
+	}
+	return &Pin{
+		alias:  alias,
+		number: line.Number,
+		chip:   line.Chip,
+		offset: line.Offset,
+		drv:    &cdevDriver{lines: lines},
+	}, nil
+}
+
+func inspectCdev(line LineInfo) (LineState, error) {
+	chip, err := os.Open(filepath.Join(DefaultResolver.Root(), "dev", line.Chip))
+	if err != nil {
+		return LineState{LineInfo: line}, err
+	}
+	defer chip.Close()
+	info, err := lineInfo(chip, uint32(line.Offset))
+	if err != nil {
+		return LineState{LineInfo: line}, err
+	}
+	return lineStateFromInfo(line, info), nil
+}
+
+func lineStateFromInfo(line LineInfo, info gpioV2LineInfo) LineState {
+	state := LineState{
+		LineInfo:  line,
+		Used:      info.flags&GPIO_V2_LINE_FLAG_USED != 0,
+		Consumer:  cString(info.consumer[:]),
+		Direction: IN,
+		Edge:      edgeFromFlags(info.flags),
+		ActiveLow: info.flags&GPIO_V2_LINE_FLAG_ACTIVE_LOW != 0,
+	}
+	if info.flags&GPIO_V2_LINE_FLAG_OUTPUT != 0 {
+		state.Direction = OUT
+	}
+	return state
+}
+
+// cdevPortGroup holds the lines of a port which belong to one gpiochip,
+// bits[i] is the port bit of the i-th line of the request
+type cdevPortGroup struct {
+	lines *cdevLines
+	bits  []int
+}
+
+type cdevPort struct {
+	groups []cdevPortGroup
+}
+
+func newCdevPort(aliases []Alias) (*cdevPort, error) {
+	offsets := map[string][]uint32{}
+	bits := map[string][]int{}
+	chips := []string{}
+	for bit, alias := range aliases {
+		line, err := DefaultResolver.Resolve(alias)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find gpio line %s: %w", alias, err)
+		}
+		if _, ok := offsets[line.Chip]; !ok {
+			chips = append(chips, line.Chip)
+		}
+		offsets[line.Chip] = append(offsets[line.Chip], uint32(line.Offset))
+		bits[line.Chip] = append(bits[line.Chip], bit)
+	}
+	port := &cdevPort{}
+	for _, chip := range chips {
+		lines, err := requestLines(filepath.Join(DefaultResolver.Root(), "dev", chip), offsets[chip], 0, 0)
+		if err != nil {
+			port.close()
+			return nil, fmt.Errorf("unable to request gpio lines of %s: %w", chip, err)
+		}
+		port.groups = append(port.groups, cdevPortGroup{lines: lines, bits: bits[chip]})
+	}
+	return port, nil
+}
+
+func (p *cdevPort) values() (uint64, error) {
+	var bits uint64
+	for _, group := range p.groups {
+		values, err := group.lines.values(lineMask(len(group.bits)))
+		if err != nil {
+			return 0, err
+		}
+		for i, bit := range group.bits {
+			bits |= (values >> i & 1) << bit
+		}
+	}
+	return bits, nil
+}
+
+func (p *cdevPort) setValues(bits uint64, mask uint64) error {
+	for _, group := range p.groups {
+		var values, valuesMask uint64
+		for i, bit := range group.bits {
+			values |= (bits >> bit & 1) << i
+			valuesMask |= (mask >> bit & 1) << i
+		}
+		if valuesMask == 0 {
+			continue
+		}
+		if err := group.lines.setValues(values, valuesMask); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *cdevPort) setDirection(direction Direction) error {
+	for _, group := range p.groups {
+		flags, err := withDirection(group.lines.flags, direction)
+		if err != nil {
+			return err
+		}
+		if err := group.lines.setConfig(flags, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *cdevPort) atomic() bool {
+	return len(p.groups) == 1
+}
+
+func (p *cdevPort) close() error {
+	errs := []error{}
+	for _, group := range p.groups {
+		if err := group.lines.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	p.groups = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,137 @@
+//go:build linux
+// +build linux
+
+package gpio
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// the sizes are encoded in the ioctl numbers, a mismatch makes the kernel reject the calls
+func TestCdevStructSizes(t *testing.T) {
+	sizes := []struct {
+		name     string
+		size     uintptr
+		expected uintptr
+	}{
+		{"gpiochip_info", unsafe.Sizeof(gpioChipInfo{}), GPIO_GET_CHIPINFO_IOCTL >> 16 & 0x3FFF},
+		{"gpio_v2_line_info", unsafe.Sizeof(gpioV2LineInfo{}), GPIO_V2_GET_LINEINFO_IOCTL >> 16 & 0x3FFF},
+		{"gpio_v2_line_request", unsafe.Sizeof(gpioV2LineRequest{}), GPIO_V2_GET_LINE_IOCTL >> 16 & 0x3FFF},
+		{"gpio_v2_line_config", unsafe.Sizeof(gpioV2LineConfig{}), GPIO_V2_LINE_SET_CONFIG_IOCTL >> 16 & 0x3FFF},
+		{"gpio_v2_line_values", unsafe.Sizeof(gpioV2LineValues{}), GPIO_V2_LINE_GET_VALUES_IOCTL >> 16 & 0x3FFF},
+		{"gpio_v2_line_event", unsafe.Sizeof(gpioV2LineEvent{}), 48},
+	}
+	for _, s := range sizes {
+		if s.size != s.expected {
+			t.Errorf("%s is %d bytes, expected %d", s.name, s.size, s.expected)
+		}
+	}
+}
+
+func TestWithDirection(t *testing.T) {
+	tests := []struct {
+		flags     uint64
+		direction Direction
+		expected  uint64
+	}{
+		{0, IN, GPIO_V2_LINE_FLAG_INPUT},
+		{0, OUT, GPIO_V2_LINE_FLAG_OUTPUT},
+		// edge detection is dropped for outputs, open drain for inputs
+		{GPIO_V2_LINE_FLAG_INPUT | gpioV2LineEdgeFlags | GPIO_V2_LINE_FLAG_BIAS_PULL_UP, OUT, GPIO_V2_LINE_FLAG_OUTPUT | GPIO_V2_LINE_FLAG_BIAS_PULL_UP},
+		{GPIO_V2_LINE_FLAG_OUTPUT | GPIO_V2_LINE_FLAG_OPEN_DRAIN | GPIO_V2_LINE_FLAG_ACTIVE_LOW, IN, GPIO_V2_LINE_FLAG_INPUT | GPIO_V2_LINE_FLAG_ACTIVE_LOW},
+	}
+	for _, test := range tests {
+		if flags, err := withDirection(test.flags, test.direction); err != nil || flags != test.expected {
+			t.Errorf("withDirection(%#x, %s) = %#x, %v, expected %#x", test.flags, test.direction, flags, err, test.expected)
+		}
+	}
+	if _, err := withDirection(0, "sideways"); err == nil {
+		t.Error("expected an unknown direction to fail")
+	}
+}
+
+func TestFlagEncoding(t *testing.T) {
+	drives := map[Drive]uint64{
+		PUSH_PULL:   0,
+		OPEN_DRAIN:  GPIO_V2_LINE_FLAG_OPEN_DRAIN,
+		OPEN_SOURCE: GPIO_V2_LINE_FLAG_OPEN_SOURCE,
+	}
+	for drive, expected := range drives {
+		if flags := driveFlags(drive); flags != expected {
+			t.Errorf("driveFlags(%s) = %#x, expected %#x", drive, flags, expected)
+		}
+	}
+	edges := map[uint64]Edge{
+		GPIO_V2_LINE_FLAG_INPUT:                                  NONE,
+		GPIO_V2_LINE_FLAG_INPUT | GPIO_V2_LINE_FLAG_EDGE_RISING:  RISING,
+		GPIO_V2_LINE_FLAG_INPUT | GPIO_V2_LINE_FLAG_EDGE_FALLING: FALLING,
+		GPIO_V2_LINE_FLAG_INPUT | gpioV2LineEdgeFlags:            BOTH,
+	}
+	for flags, expected := range edges {
+		if edge := edgeFromFlags(flags); edge != expected {
+			t.Errorf("edgeFromFlags(%#x) = %s, expected %s", flags, edge, expected)
+		}
+	}
+}
+
+func TestLineConfig(t *testing.T) {
+	config := lineConfig(GPIO_V2_LINE_FLAG_INPUT, 1, 3)
+	if config.flags != GPIO_V2_LINE_FLAG_INPUT || config.numAttrs != 0 {
+		t.Errorf("unexpected input config %+v", config)
+	}
+	// outputs get their initial values as an attribute for all lines
+	config = lineConfig(GPIO_V2_LINE_FLAG_OUTPUT, 0b101, 3)
+	attr := config.attrs[0]
+	if config.numAttrs != 1 || attr.attr.id != GPIO_V2_LINE_ATTR_ID_OUTPUT_VALUES || attr.attr.value != 0b101 || attr.mask != 0b111 {
+		t.Errorf("unexpected output config %+v", config)
+	}
+}
+
+func TestEventFromLineEvent(t *testing.T) {
+	event := eventFromLineEvent(gpioV2LineEvent{timestampNs: 1500, id: GPIO_V2_LINE_EVENT_FALLING_EDGE, seqno: 9, lineSeqno: 4})
+	if event.Edge != FALLING || event.Timestamp != 1500*time.Nanosecond || event.Seqno != 4 {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if event := eventFromLineEvent(gpioV2LineEvent{id: GPIO_V2_LINE_EVENT_RISING_EDGE}); event.Edge != RISING {
+		t.Errorf("unexpected edge %s", event.Edge)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	tests := []struct {
+		err         error
+		unsupported bool
+	}{
+		{syscall.EOPNOTSUPP, true},
+		{ENOTSUPP, true},
+		{syscall.EINVAL, false},
+		{syscall.EBUSY, false},
+	}
+	for _, test := range tests {
+		err := unsupported(test.err)
+		if errors.Is(err, ErrUnsupported) != test.unsupported || !errors.Is(err, test.err) {
+			t.Errorf("unsupported(%v) = %v", test.err, err)
+		}
+	}
+	if err := unsupported(nil); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestLineStateFromInfo(t *testing.T) {
+	line := LineInfo{Alias: P8_03, Chip: "gpiochip1", Offset: 1, Number: 426}
+	info := gpioV2LineInfo{flags: GPIO_V2_LINE_FLAG_USED | GPIO_V2_LINE_FLAG_INPUT | gpioV2LineEdgeFlags | GPIO_V2_LINE_FLAG_ACTIVE_LOW}
+	copy(info.consumer[:], "robot")
+	state := lineStateFromInfo(line, info)
+	if !state.Used || state.Consumer != "robot" || state.Direction != IN || state.Edge != BOTH || !state.ActiveLow || state.Value != nil {
+		t.Errorf("unexpected state %+v", state)
+	}
+	state = lineStateFromInfo(line, gpioV2LineInfo{flags: GPIO_V2_LINE_FLAG_OUTPUT})
+	if state.Used || state.Direction != OUT || state.Edge != NONE {
+		t.Errorf("unexpected state %+v", state)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package gpio
+
+import (
+	"errors"
+)
+
+var noCdevImplementationError = errors.New("There is no implementation of gpio character device for this platform!")
+
+func exportCdev(alias Alias) (*Pin, error) {
+	return nil, noCdevImplementationError
+}
+
+func readChipLines(path string) (string, []string, error) {
+	return "", nil, noCdevImplementationError
+}
+
+func newCdevPort(aliases []Alias) (portDriver, error) {
+	return nil, noCdevImplementationError
+}
+
+func inspectCdev(line LineInfo) (LineState, error) {
+	return LineState{LineInfo: line}, noCdevImplementationError
+}
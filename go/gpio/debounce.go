@@ -0,0 +1,110 @@
+package gpio
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DebounceConfig describes how long an input has to stay at a level to be trusted
+type DebounceConfig struct {
+	Stable      time.Duration // minimum stable time for both levels
+	Rising      time.Duration // overrides Stable for the HIGH level when not zero
+	Falling     time.Duration // overrides Stable for the LOW level when not zero
+	SettledOnly bool          // report a change only once it has been stable, instead of on its first edge
+}
+
+func (c DebounceConfig) filter(level Value) time.Duration {
+	if level == HIGH && c.Rising > 0 {
+		return c.Rising
+	}
+	if level == LOW && c.Falling > 0 {
+		return c.Falling
+	}
+	return c.Stable
+}
+
+func levelOf(edge Edge) Value {
+	if edge == RISING {
+		return HIGH
+	}
+	return LOW
+}
+
+// Debounce filters a stream of raw edges, initial is the level of the input when the stream starts.
+//
+// By default the first edge of a change is reported immediately and the following bounces are ignored
+// until the input has been quiet for the stable time of its level. If the bounces settle on
+// the opposite level, that change is reported once it is stable.
+// With SettledOnly an edge is only reported after the input has kept its level for the stable time,
+// so glitches shorter than that never show up.
+//
+// Seqno of the produced events counts the reported changes, the channel is closed with the input.
+func Debounce(events <-chan Event, initial Value, config DebounceConfig) <-chan Event {
+	out := make(chan Event, EVENTS_BUFFER_SIZE)
+	go func() {
+		defer close(out)
+		timer := time.NewTimer(time.Hour)
+		timer.Stop()
+		defer timer.Stop()
+
+		level := initial
+		reported := initial
+		locked := false
+		var changedAt time.Duration
+		var seqno uint32
+		report := func(timestamp time.Duration) {
+			reported = level
+			seqno++
+			edge := FALLING
+			if level == HIGH {
+				edge = RISING
+			}
+			select {
+			case out <- Event{Edge: edge, Timestamp: timestamp, Seqno: seqno}:
+			default:
+			}
+		}
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				level = levelOf(event.Edge)
+				changedAt = event.Timestamp
+				if !config.SettledOnly && !locked && level != reported {
+					report(changedAt)
+					locked = true
+				}
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(config.filter(level))
+			case <-timer.C:
+				locked = false
+				if level != reported {
+					report(changedAt)
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// DebouncedEvents is Events filtered with Debounce, starting from the current value of the pin.
+// The edge of the pin should be set to BOTH, so the filter can follow the level of the input.
+func (p *Pin) DebouncedEvents(ctx context.Context, config DebounceConfig) (<-chan Event, error) {
+	initial, err := p.Value()
+	if err != nil {
+		return nil, err
+	}
+	events, err := p.Events(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to debounce gpio %s: %w", p, err)
+	}
+	return Debounce(events, initial, config), nil
+}
@@ -0,0 +1,61 @@
+package gpio
+
+import (
+	"testing"
+	"time"
+)
+
+func bounce(in chan<- Event, edges ...Edge) {
+	for i, edge := range edges {
+		in <- Event{Edge: edge, Timestamp: time.Duration(i) * time.Millisecond, Seqno: uint32(i + 1)}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func expectEvents(t *testing.T, out <-chan Event, edges ...Edge) {
+	for _, edge := range edges {
+		select {
+		case event := <-out:
+			if event.Edge != edge {
+				t.Fatalf("expected %s, got %+v", edge, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", edge)
+		}
+	}
+	select {
+	case event, ok := <-out:
+		if ok {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDebounceLeadingEdge(t *testing.T) {
+	in := make(chan Event)
+	out := Debounce(in, LOW, DebounceConfig{Stable: 30 * time.Millisecond})
+	bounce(in, RISING, FALLING, RISING, FALLING, RISING)
+	select {
+	case event := <-out:
+		if event.Edge != RISING || event.Timestamp != 0 || event.Seqno != 1 {
+			t.Fatalf("expected the first rising edge, got %+v", event)
+		}
+	default:
+		t.Fatal("expected the first edge to be reported immediately")
+	}
+	expectEvents(t, out)
+	bounce(in, FALLING, RISING, FALLING)
+	expectEvents(t, out, FALLING)
+	close(in)
+}
+
+func TestDebounceSettledOnly(t *testing.T) {
+	in := make(chan Event)
+	out := Debounce(in, LOW, DebounceConfig{Stable: 30 * time.Millisecond, Falling: 60 * time.Millisecond, SettledOnly: true})
+	bounce(in, RISING, FALLING)
+	expectEvents(t, out)
+	bounce(in, RISING, FALLING, RISING)
+	expectEvents(t, out, RISING)
+	close(in)
+}
@@ -1,32 +1,11 @@
 package gpio
 
-/*
-#ifndef GPIO_HELPER_H_
-#define GPIO_HELPER_H_
-
-#cgo CFLAGS: -std=c99
-#cgo CXXFLAGS: -std=c99
-
-#include <poll.h>
-
-void GpioPoll(int fd)
-{
-	struct pollfd pfd;
-	pfd.fd = fd;
-	pfd.events = POLLPRI | POLLERR;
-	pfd.revents = 0;
-	poll(&pfd, 1, -1);
-}
-
-#endif // GPIO_HELPER_H_
-*/
-import "C"
 import (
+	"bbai64/registry"
+	"bbai64/sysfs"
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
-	"strconv"
-	"strings"
 )
 
 type Alias string
@@ -133,19 +112,88 @@ const (
 	OUT Direction = "out"
 )
 
+type Backend string
+
+const (
+	SYSFS Backend = "sysfs"
+	CDEV  Backend = "cdev"
+)
+
+// BACKEND_ENV overrides the automatically detected backend when set to "sysfs" or "cdev"
+const BACKEND_ENV = "GPIO_BACKEND"
+
+var backend Backend
+
+// ErrUserspaceTimestamps is returned by drivers measuring pulses, which need the edges timestamped by the kernel
+var ErrUserspaceTimestamps = fmt.Errorf("the %s backend timestamps edges in userspace, set %s=%s", SYSFS, BACKEND_ENV, CDEV)
+
+var fsRoot sysfs.FS = sysfs.Host
+
+// SetFS makes the package use another root for /sys and /dev, e.g. a fake tree in tests.
+// It also replaces DefaultResolver.
+func SetFS(fsys sysfs.FS) {
+	fsRoot = fsys
+	DefaultResolver = NewResolver(fsys.Root())
+}
+
+// SetBackend forces the backend used by Export. An empty value restores auto detection.
+func SetBackend(b Backend) {
+	backend = b
+}
+
+// ActiveBackend returns the backend Export will use: the one set with SetBackend,
+// the one from BACKEND_ENV, or sysfs if /sys/class/gpio is available and cdev otherwise.
+func ActiveBackend() Backend {
+	if backend != "" {
+		return backend
+	}
+	switch b := Backend(os.Getenv(BACKEND_ENV)); b {
+	case SYSFS, CDEV:
+		return b
+	}
+	if _, err := fsRoot.Stat("/sys/class/gpio/export"); err == nil {
+		return SYSFS
+	}
+	return CDEV
+}
+
+type driver interface {
+	value() (Value, error)
+	setValue(value Value) error
+	direction() (Direction, error)
+	setDirection(direction Direction) error
+	edge() (Edge, error)
+	setEdge(edge Edge) error
+	setBias(bias Bias) error
+	setDrive(drive Drive) error
+	setActiveLow(activeLow bool) error
+	watchFd() (fd int, priority bool)
+	arm() error
+	readEvents(events []Event) ([]Event, error)
+	close() error
+}
+
 type Pin struct {
 	alias     Alias
 	number    Number
-	direction string
-	edge      string
-	buff      []byte
-	f         *os.File
+	chip      string
+	offset    int
+	bias      Bias
+	drive     Drive
+	activeLow bool
+	safe      *SafeState
+	claimed   bool // holds a claim in DefaultChecker, released by Unexport
+	drv       driver
 }
 
 func (p Pin) String() string {
-	return fmt.Sprintf("%d \"%s\"", p.number, p.alias)
+	if p.number < 0 {
+		return fmt.Sprintf("%s:%d \"%s\"%s", p.chip, p.offset, p.alias, p.optionsString())
+	}
+	return fmt.Sprintf("%d \"%s\"%s", p.number, p.alias, p.optionsString())
 }
 
+// Number returns the sysfs gpio number, or -1 if it is unknown
 func (p *Pin) Number() Number {
 	return p.number
 }
@@ -154,115 +202,133 @@ func (p *Pin) Alias() Alias {
 	return p.alias
 }
 
+// Backend returns the backend the pin was exported with. Only cdev timestamps the edges in the kernel,
+// sysfs timestamps them when they are read in userspace and infers the edge from the value.
+func (p *Pin) Backend() Backend {
+	if _, ok := p.drv.(*sysfsDriver); ok {
+		return SYSFS
+	}
+	return CDEV
+}
+
+// Chip returns the gpiochip name the pin belongs to, if known
+func (p *Pin) Chip() string {
+	return p.chip
+}
+
+// Offset returns the line offset within the gpiochip, if known
+func (p *Pin) Offset() int {
+	return p.offset
+}
+
+// Poll blocks until the next edge and returns the value after it, see WaitForEdge
 func (p *Pin) Poll() (Value, error) {
-	p.f.Seek(0, 0)
-	if _, err := p.f.Read(p.buff); err != nil {
-		return LOW, fmt.Errorf("unable to read gpio value of %s: %w", p, err)
+	if _, err := p.WaitForEdge(context.Background()); err != nil {
+		return LOW, fmt.Errorf("unable to poll gpio %s: %w", p, err)
 	}
-	C.GpioPoll(C.int(p.f.Fd()))
 	return p.Value()
 }
 
 func (p *Pin) Value() (Value, error) {
-	p.f.Seek(0, 0)
-	_, err := p.f.Read(p.buff)
+	value, err := p.drv.value()
 	if err != nil {
 		return LOW, fmt.Errorf("unable to read gpio value of %s: %w", p, err)
 	}
-	value, err := strconv.Atoi(string(p.buff))
-	if err != nil {
-		return LOW, fmt.Errorf("unable to convert gpio value of %s: %w", p, err)
-	}
-	return Value(value), nil
+	return value, nil
 }
 
 func (p *Pin) SetValue(value Value) error {
-	p.buff[0] = byte(value) + '0'
-	_, err := p.f.Write([]byte(p.buff))
-	if err != nil {
+	if err := p.drv.setValue(value); err != nil {
 		return fmt.Errorf("unable to set gpio value for %s: %w", p, err)
 	}
 	return nil
 }
 
 func (p *Pin) Direction() (Direction, error) {
-	data, err := os.ReadFile(p.direction)
+	direction, err := p.drv.direction()
 	if err != nil {
 		return IN, fmt.Errorf("unable to read gpio direction of %s: %w", p, err)
 	}
-	return Direction(data), nil
+	return direction, nil
 }
 
 func (p *Pin) SetDirection(direction Direction) error {
-	err := os.WriteFile(p.direction, []byte(direction), 0666)
-	if err != nil {
+	if err := checkPinDirection(p.alias, direction); err != nil {
+		return fmt.Errorf("unable to set gpio direction for %s: %w", p, err)
+	}
+	if err := p.drv.setDirection(direction); err != nil {
 		return fmt.Errorf("unable to set gpio direction for %s: %w", p, err)
 	}
 	return nil
 }
 
 func (p *Pin) Edge() (Edge, error) {
-	data, err := os.ReadFile(p.edge)
+	edge, err := p.drv.edge()
 	if err != nil {
 		return NONE, fmt.Errorf("unable to read gpio edge of %s: %w", p, err)
 	}
-	return Edge(data), nil
+	return edge, nil
 }
 
 func (p *Pin) SetEdge(edge Edge) error {
-	err := os.WriteFile(p.edge, []byte(edge), 0666)
-	if err != nil {
+	if err := p.drv.setEdge(edge); err != nil {
 		return fmt.Errorf("unable to set gpio edge for %s: %w", p, err)
 	}
 	return nil
 }
 
 func (p *Pin) Unexport() error {
-	p.f.Close()
-	value := fmt.Sprintf("%d", p.number)
-	err := os.WriteFile("/sys/class/gpio/unexport", []byte(value), 0666)
-	if err != nil {
+	registry.Unregister(p)
+	if p.claimed {
+		DefaultChecker.Release(p.alias)
+		p.claimed = false
+	}
+	defaultWatcher.remove(p)
+	if err := p.drv.close(); err != nil {
 		return fmt.Errorf("unable to unexport gpio %s: %w", p, err)
 	}
 	return nil
 }
 
-func Export(alias Alias) (*Pin, error) {
-	number, err := GrepNumber(alias)
+// Export claims the pin through the active backend, see ActiveBackend,
+// and applies the options. The pin is unexported again if an option fails.
+// A header pin already used for another function in the process, see DefaultChecker, is rejected.
+func Export(alias Alias, options ...Option) (*Pin, error) {
+	claimed, err := claimPin(alias, IN)
 	if err != nil {
-		return nil, err
-	}
-	value := fmt.Sprintf("%d", number)
-	if err := os.WriteFile("/sys/class/gpio/export", []byte(value), 0666); err != nil {
 		return nil, fmt.Errorf("unable to export gpio %s: %w", alias, err)
 	}
-	file, err := os.OpenFile(fmt.Sprintf("/sys/class/gpio/gpio%d/value", number), os.O_RDWR, 0666)
+	var pin *Pin
+	if ActiveBackend() == CDEV {
+		pin, err = exportCdev(alias)
+	} else {
+		pin, err = exportSysfs(alias)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("unable to open gpio %s: %w", alias, err)
+		if claimed {
+			DefaultChecker.Release(alias)
+		}
+		return nil, err
 	}
-	return &Pin{
-		number:    Number(number),
-		alias:     alias,
-		f:         file,
-		buff:      make([]byte, 1),
-		direction: fmt.Sprintf("/sys/class/gpio/gpio%d/direction", number),
-		edge:      fmt.Sprintf("/sys/class/gpio/gpio%d/edge", number),
-	}, nil
+	pin.claimed = claimed
+	for _, option := range options {
+		if err := option(pin); err != nil {
+			pin.Unexport()
+			return nil, err
+		}
+	}
+	registry.Register(pin)
+	return pin, nil
 }
 
+// GrepNumber resolves the legacy sysfs gpio number of the alias, see Resolver
 func GrepNumber(alias Alias) (int, error) {
-	cmd := exec.Command(
-		"bash", "-c",
-		fmt.Sprintf("expr $(ls -l /sys/class/gpio/gpiochip* | grep $(gpiodetect | grep $(gpiofind \"%[1]s\" | grep -o -E \"gpiochip[0-9]+\") | grep -o -E \"[0-9]+\\.gpio\") | grep -o -E \"[0-9]+$\") + $(gpiofind \"%[1]s\" | grep -o -E \"[0-9]+$\")", alias))
-	stdout, err := cmd.Output()
+	line, err := DefaultResolver.Resolve(alias)
 	if err != nil {
 		return 0, fmt.Errorf("unable to grep gpio number for %s: %w", alias, err)
 	}
-	number, err := strconv.Atoi(
-		strings.Trim(string(stdout), "\n\r"),
-	)
-	if err != nil {
-		return 0, fmt.Errorf("unable to convert gpio number for %s: %w", alias, err)
+	if line.Number < 0 {
+		return 0, fmt.Errorf("unable to grep gpio number for %s: %s is not visible in /sys/class/gpio", alias, line.Chip)
 	}
-	return number, nil
+	return int(line.Number), nil
 }
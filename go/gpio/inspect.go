@@ -0,0 +1,81 @@
+package gpio
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LineState is the state of a line read without requesting or exporting it
+type LineState struct {
+	LineInfo
+	Used      bool      `json:"used"`               // requested through cdev or exported in sysfs
+	Consumer  string    `json:"consumer,omitempty"` // label of the cdev requester
+	Direction Direction `json:"direction,omitempty"`
+	Edge      Edge      `json:"edge,omitempty"`
+	ActiveLow bool      `json:"activeLow"`
+	Value     *Value    `json:"value,omitempty"` // only known for lines exported in sysfs
+}
+
+// Inspect reads the state of the line through the active backend, see ActiveBackend,
+// without claiming it, so lines used by other processes can be inspected too.
+// cdev reads the line info of the gpiochip, which does not tell the value.
+// sysfs reads the files of a line exported by someone else, the state of other lines is unknown.
+func Inspect(alias Alias) (LineState, error) {
+	line, err := DefaultResolver.Resolve(alias)
+	if err != nil {
+		return LineState{}, fmt.Errorf("unable to find gpio line %s: %w", alias, err)
+	}
+	var state LineState
+	if ActiveBackend() == CDEV {
+		state, err = inspectCdev(line)
+	} else {
+		state, err = inspectSysfs(line)
+	}
+	if err != nil {
+		return state, fmt.Errorf("unable to inspect gpio %s: %w", alias, err)
+	}
+	return state, nil
+}
+
+func inspectSysfs(line LineInfo) (LineState, error) {
+	state := LineState{LineInfo: line}
+	if line.Number < 0 {
+		return state, fmt.Errorf("%s is not visible in /sys/class/gpio", line.Chip)
+	}
+	dir := fmt.Sprintf("/sys/class/gpio/gpio%d", line.Number)
+	if _, err := fsRoot.Stat(dir); err != nil {
+		return state, nil
+	}
+	state.Used = true
+	read := func(attr string) (string, error) {
+		data, err := fsRoot.ReadFile(dir + "/" + attr)
+		return strings.TrimSpace(string(data)), err
+	}
+	direction, err := read("direction")
+	if err != nil {
+		return state, err
+	}
+	state.Direction = Direction(direction)
+	edge, err := read("edge")
+	if err != nil {
+		return state, err
+	}
+	state.Edge = Edge(edge)
+	activeLow, err := read("active_low")
+	if err != nil {
+		return state, err
+	}
+	state.ActiveLow = activeLow == "1"
+	data, err := read("value")
+	if err != nil {
+		return state, err
+	}
+	value, err := strconv.Atoi(data)
+	if err != nil {
+		return state, err
+	}
+	state.Value = new(Value)
+	*state.Value = Value(value)
+	return state, nil
+}
@@ -0,0 +1,53 @@
+package gpio_test
+
+import (
+	"bbai64/gpio"
+	"bbai64/hwtest"
+	"bbai64/sysfs"
+	"testing"
+)
+
+func TestInspectSysfs(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddGPIOChip("gpiochip1", "600000.gpio", 425, "", string(gpio.P8_03), string(gpio.P8_04))
+	gpio.SetBackend(gpio.SYSFS)
+	gpio.SetFS(tree)
+	defer gpio.SetBackend("")
+	defer gpio.SetFS(sysfs.Host)
+
+	// a line nobody exported is left alone
+	tree.ResetWrites()
+	state, err := gpio.Inspect(gpio.P8_03)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Used || state.Value != nil || state.Number != 426 {
+		t.Errorf("unexpected state %+v", state)
+	}
+	if writes := tree.Writes(); len(writes) != 0 {
+		t.Errorf("expected no writes, got %v", writes)
+	}
+
+	pin, err := gpio.Export(gpio.P8_04)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pin.Unexport()
+	if err := pin.SetDirection(gpio.OUT); err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.SetValue(gpio.HIGH); err != nil {
+		t.Fatal(err)
+	}
+	tree.ResetWrites()
+	state, err = gpio.Inspect(gpio.P8_04)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Used || state.Direction != gpio.OUT || state.Edge != gpio.NONE || state.Value == nil || *state.Value != gpio.HIGH {
+		t.Errorf("unexpected state %+v", state)
+	}
+	if writes := tree.Writes(); len(writes) != 0 {
+		t.Errorf("expected no writes, got %v", writes)
+	}
+}
@@ -0,0 +1,122 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Bias string
+
+const (
+	AS_IS     Bias = "as-is"
+	DISABLED  Bias = "disabled"
+	PULL_UP   Bias = "pull-up"
+	PULL_DOWN Bias = "pull-down"
+)
+
+type Drive string
+
+const (
+	PUSH_PULL   Drive = "push-pull"
+	OPEN_DRAIN  Drive = "open-drain"
+	OPEN_SOURCE Drive = "open-source"
+)
+
+// ErrUnsupported is returned when the backend or the line can't apply an option
+var ErrUnsupported = errors.New("not supported")
+
+// Option configures a pin on Export
+type Option func(p *Pin) error
+
+// WithBias enables the internal pull-up or pull-down resistor, cdev backend only
+func WithBias(bias Bias) Option {
+	return func(p *Pin) error {
+		return p.SetBias(bias)
+	}
+}
+
+// WithDrive selects open-drain or open-source outputs, cdev backend only.
+// It takes effect whenever the pin is an output.
+func WithDrive(drive Drive) Option {
+	return func(p *Pin) error {
+		return p.SetDrive(drive)
+	}
+}
+
+// WithActiveLow inverts the logical value of the pin, for values and edges alike
+func WithActiveLow() Option {
+	return func(p *Pin) error {
+		return p.SetActiveLow(true)
+	}
+}
+
+func (p *Pin) Bias() Bias {
+	if p.bias == "" {
+		return AS_IS
+	}
+	return p.bias
+}
+
+func (p *Pin) SetBias(bias Bias) error {
+	switch bias {
+	case AS_IS, DISABLED, PULL_UP, PULL_DOWN:
+	default:
+		return fmt.Errorf("unable to set gpio bias for %s: unknown bias %q", p, bias)
+	}
+	if err := p.drv.setBias(bias); err != nil {
+		return fmt.Errorf("unable to set gpio bias %s for %s: %w", bias, p, err)
+	}
+	p.bias = bias
+	return nil
+}
+
+func (p *Pin) Drive() Drive {
+	if p.drive == "" {
+		return PUSH_PULL
+	}
+	return p.drive
+}
+
+func (p *Pin) SetDrive(drive Drive) error {
+	switch drive {
+	case PUSH_PULL, OPEN_DRAIN, OPEN_SOURCE:
+	default:
+		return fmt.Errorf("unable to set gpio drive for %s: unknown drive %q", p, drive)
+	}
+	if err := p.drv.setDrive(drive); err != nil {
+		return fmt.Errorf("unable to set gpio drive %s for %s: %w", drive, p, err)
+	}
+	p.drive = drive
+	return nil
+}
+
+func (p *Pin) ActiveLow() bool {
+	return p.activeLow
+}
+
+func (p *Pin) SetActiveLow(activeLow bool) error {
+	if err := p.drv.setActiveLow(activeLow); err != nil {
+		return fmt.Errorf("unable to set gpio active low for %s: %w", p, err)
+	}
+	p.activeLow = activeLow
+	return nil
+}
+
+// optionsString lists the options which differ from the defaults, e.g. " (pull-up, active-low)"
+func (p Pin) optionsString() string {
+	options := []string{}
+	if p.Bias() != AS_IS {
+		options = append(options, string(p.bias))
+	}
+	if p.Drive() != PUSH_PULL {
+		options = append(options, string(p.drive))
+	}
+	if p.activeLow {
+		options = append(options, "active-low")
+	}
+	if len(options) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(options, ", ") + ")"
+}
@@ -0,0 +1,371 @@
+package gpio
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// based on: https://docs.beagleboard.org/latest/boards/capes/cape-interface-spec.html (bone bus assignments)
+
+type Function string
+
+const (
+	FUNC_GPIO Function = "gpio"
+	FUNC_PWM  Function = "pwm"
+	FUNC_I2C  Function = "i2c"
+	FUNC_UART Function = "uart"
+	FUNC_SPI  Function = "spi"
+	FUNC_ECAP Function = "ecap"
+	FUNC_EQEP Function = "eqep"
+)
+
+// Mux is a function a header pin can be muxed to.
+// Instance is the bone bus number (e.g. 0 for /dev/bone/pwm/0) and Signal the line of that bus.
+type Mux struct {
+	Function Function `json:"function"`
+	Instance int      `json:"instance"`
+	Signal   string   `json:"signal"`
+}
+
+func (m Mux) String() string {
+	if m.Function == FUNC_GPIO {
+		return string(FUNC_GPIO)
+	}
+	return fmt.Sprintf("%s%d.%s", m.Function, m.Instance, m.Signal)
+}
+
+type HeaderPin struct {
+	Alias     Alias  `json:"alias"`
+	Header    string `json:"header"`
+	Number    int    `json:"number"`
+	Shared    bool   `json:"shared"`   // two SoC balls are tied to this pin, the unused one has to stay an input
+	BootMode  int    `json:"bootMode"` // BOOTMODE bit sampled at reset, -1 if none
+	Functions []Mux  `json:"functions"`
+}
+
+// Name returns the header pin name without the ball suffix and notes, e.g. "P9_22"
+func (h HeaderPin) Name() string {
+	return fmt.Sprintf("%s_%02d", h.Header, h.Number)
+}
+
+func (h HeaderPin) Supports(mux Mux) bool {
+	for _, function := range h.Functions {
+		if function == mux {
+			return true
+		}
+	}
+	return false
+}
+
+// HeaderPins lists every P8/P9 pin available as a gpio
+var HeaderPins = []HeaderPin{
+	{Alias: P8_03, Header: "P8", Number: 3, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_04, Header: "P8", Number: 4, Shared: false, BootMode: 2, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_05, Header: "P8", Number: 5, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_06, Header: "P8", Number: 6, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_07, Header: "P8", Number: 7, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_08, Header: "P8", Number: 8, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_09, Header: "P8", Number: 9, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_10, Header: "P8", Number: 10, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_11, Header: "P8", Number: 11, Shared: false, BootMode: 7, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_EQEP, Instance: 2, Signal: "b"}}},
+	{Alias: P8_12, Header: "P8", Number: 12, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_EQEP, Instance: 2, Signal: "a"}}},
+	{Alias: P8_13, Header: "P8", Number: 13, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_PWM, Instance: 2, Signal: "b"}}},
+	{Alias: P8_14, Header: "P8", Number: 14, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_15, Header: "P8", Number: 15, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_16, Header: "P8", Number: 16, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_17, Header: "P8", Number: 17, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_18, Header: "P8", Number: 18, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_19, Header: "P8", Number: 19, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_PWM, Instance: 2, Signal: "a"}}},
+	{Alias: P8_20, Header: "P8", Number: 20, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_21, Header: "P8", Number: 21, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_22, Header: "P8", Number: 22, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_23, Header: "P8", Number: 23, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_24, Header: "P8", Number: 24, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_25, Header: "P8", Number: 25, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_26, Header: "P8", Number: 26, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_27, Header: "P8", Number: 27, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_28, Header: "P8", Number: 28, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_29, Header: "P8", Number: 29, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_30, Header: "P8", Number: 30, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_31, Header: "P8", Number: 31, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_32, Header: "P8", Number: 32, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_33, Header: "P8", Number: 33, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_EQEP, Instance: 1, Signal: "b"}}},
+	{Alias: P8_34, Header: "P8", Number: 34, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_35, Header: "P8", Number: 35, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_EQEP, Instance: 1, Signal: "a"}}},
+	{Alias: P8_36, Header: "P8", Number: 36, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_37, Header: "P8", Number: 37, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_UART, Instance: 5, Signal: "tx"}}},
+	{Alias: P8_38, Header: "P8", Number: 38, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_UART, Instance: 5, Signal: "rx"}}},
+	{Alias: P8_39, Header: "P8", Number: 39, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_40, Header: "P8", Number: 40, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_41, Header: "P8", Number: 41, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_42, Header: "P8", Number: 42, Shared: false, BootMode: 6, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_43, Header: "P8", Number: 43, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_44, Header: "P8", Number: 44, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_45, Header: "P8", Number: 45, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P8_46, Header: "P8", Number: 46, Shared: false, BootMode: 3, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P9_11, Header: "P9", Number: 11, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_UART, Instance: 4, Signal: "rx"}}},
+	{Alias: P9_12, Header: "P9", Number: 12, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P9_13, Header: "P9", Number: 13, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_UART, Instance: 4, Signal: "tx"}}},
+	{Alias: P9_14, Header: "P9", Number: 14, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_PWM, Instance: 1, Signal: "a"}}},
+	{Alias: P9_15, Header: "P9", Number: 15, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P9_16, Header: "P9", Number: 16, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_PWM, Instance: 1, Signal: "b"}}},
+	{Alias: P9_17, Header: "P9", Number: 17, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_I2C, Instance: 1, Signal: "scl"}, {Function: FUNC_SPI, Instance: 0, Signal: "cs0"}}},
+	{Alias: P9_18, Header: "P9", Number: 18, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_I2C, Instance: 1, Signal: "sda"}, {Function: FUNC_SPI, Instance: 0, Signal: "d1"}}},
+	{Alias: P9_19, Header: "P9", Number: 19, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_I2C, Instance: 2, Signal: "scl"}}},
+	{Alias: P9_20, Header: "P9", Number: 20, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_I2C, Instance: 2, Signal: "sda"}}},
+	{Alias: P9_21, Header: "P9", Number: 21, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_PWM, Instance: 0, Signal: "b"}, {Function: FUNC_I2C, Instance: 4, Signal: "scl"}, {Function: FUNC_UART, Instance: 2, Signal: "tx"}, {Function: FUNC_SPI, Instance: 0, Signal: "d0"}}},
+	{Alias: P9_22, Header: "P9", Number: 22, Shared: true, BootMode: 1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_PWM, Instance: 0, Signal: "a"}, {Function: FUNC_I2C, Instance: 4, Signal: "sda"}, {Function: FUNC_UART, Instance: 2, Signal: "rx"}, {Function: FUNC_SPI, Instance: 0, Signal: "sclk"}}},
+	{Alias: P9_23, Header: "P9", Number: 23, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P9_24, Header: "P9", Number: 24, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_I2C, Instance: 3, Signal: "scl"}, {Function: FUNC_UART, Instance: 1, Signal: "tx"}}},
+	{Alias: P9_25, Header: "P9", Number: 25, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P9_26, Header: "P9", Number: 26, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_I2C, Instance: 3, Signal: "sda"}, {Function: FUNC_UART, Instance: 1, Signal: "rx"}}},
+	{Alias: P9_27, Header: "P9", Number: 27, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_EQEP, Instance: 0, Signal: "b"}}},
+	{Alias: P9_28, Header: "P9", Number: 28, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_SPI, Instance: 1, Signal: "cs0"}, {Function: FUNC_ECAP, Instance: 2, Signal: "in"}}},
+	{Alias: P9_29, Header: "P9", Number: 29, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_SPI, Instance: 1, Signal: "d0"}}},
+	{Alias: P9_30, Header: "P9", Number: 30, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_SPI, Instance: 1, Signal: "d1"}}},
+	{Alias: P9_31, Header: "P9", Number: 31, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_SPI, Instance: 1, Signal: "sclk"}}},
+	{Alias: P9_33, Header: "P9", Number: 33, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P9_35, Header: "P9", Number: 35, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P9_36, Header: "P9", Number: 36, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P9_37, Header: "P9", Number: 37, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P9_38, Header: "P9", Number: 38, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P9_39, Header: "P9", Number: 39, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P9_40, Header: "P9", Number: 40, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P9_41, Header: "P9", Number: 41, Shared: false, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}}},
+	{Alias: P9_42, Header: "P9", Number: 42, Shared: true, BootMode: -1, Functions: []Mux{{Function: FUNC_GPIO}, {Function: FUNC_UART, Instance: 3, Signal: "tx"}, {Function: FUNC_SPI, Instance: 1, Signal: "cs1"}, {Function: FUNC_ECAP, Instance: 0, Signal: "in"}, {Function: FUNC_EQEP, Instance: 0, Signal: "a"}}},
+}
+
+// LookupHeaderPin finds a pin by alias or by name like "P9_22"
+func LookupHeaderPin(name string) (HeaderPin, bool) {
+	for _, pin := range HeaderPins {
+		if string(pin.Alias) == name || pin.Name() == strings.ToUpper(name) {
+			return pin, true
+		}
+	}
+	return HeaderPin{}, false
+}
+
+// FunctionPins returns the header pins which carry the function instance, all its signals if none are given
+func FunctionPins(function Function, instance int, signals ...string) []HeaderPin {
+	pins := []HeaderPin{}
+	for _, pin := range HeaderPins {
+		for _, mux := range pin.Functions {
+			if mux.Function != function || mux.Instance != instance {
+				continue
+			}
+			if len(signals) == 0 || contains(signals, mux.Signal) {
+				pins = append(pins, pin)
+			}
+		}
+	}
+	return pins
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type ConflictError struct {
+	Pin       HeaderPin
+	Claimed   Mux
+	Requested Mux
+}
+
+func (e *ConflictError) Error() string {
+	ball := ""
+	if e.Pin.Shared {
+		ball = " (shared ball)"
+	}
+	return fmt.Sprintf("%s%s is already used as %s, can not use it as %s", e.Pin.Name(), ball, e.Claimed, e.Requested)
+}
+
+type BootModeError struct {
+	Pin HeaderPin
+	Mux Mux
+}
+
+func (e *BootModeError) Error() string {
+	return fmt.Sprintf("%s is BOOTMODE%d pin, driving it as %s at reset may prevent the board from booting", e.Pin.Name(), e.Pin.BootMode, e.Mux)
+}
+
+// Checker keeps track of how the header pins are going to be used and rejects conflicting uses.
+// Using a BOOTMODE pin as anything but a gpio input results in a warning,
+// or in a BootModeError if Strict is set.
+// The same use can be claimed several times, the pin is free once every claim is released.
+type Checker struct {
+	Strict    bool
+	OnWarning func(warning string) // called once per pin with its BOOTMODE warning, if set
+	mu        sync.Mutex
+	claims    map[Alias]Mux
+	refs      map[Alias]int
+	warnings  []string
+	warned    map[Alias]bool
+}
+
+func NewChecker(strict bool) *Checker {
+	return &Checker{
+		Strict: strict,
+		claims: map[Alias]Mux{},
+		refs:   map[Alias]int{},
+		warned: map[Alias]bool{},
+	}
+}
+
+// DefaultChecker is fed by Export, NewPort and the pwm package, so conflicting uses
+// of a pin within the process are rejected. Its warnings are logged.
+var DefaultChecker = func() *Checker {
+	checker := NewChecker(false)
+	checker.OnWarning = func(warning string) {
+		log.Print(warning)
+	}
+	return checker
+}()
+
+// claim must be called with the lock held
+func (c *Checker) claim(pin HeaderPin, mux Mux, drives bool) error {
+	if err := c.check(pin, mux, drives); err != nil {
+		return err
+	}
+	c.claims[pin.Alias] = mux
+	c.refs[pin.Alias]++
+	return nil
+}
+
+// check must be called with the lock held
+func (c *Checker) check(pin HeaderPin, mux Mux, drives bool) error {
+	if claimed, ok := c.claims[pin.Alias]; ok && claimed != mux {
+		return &ConflictError{Pin: pin, Claimed: claimed, Requested: mux}
+	}
+	if pin.BootMode >= 0 && drives && !c.warned[pin.Alias] {
+		err := &BootModeError{Pin: pin, Mux: mux}
+		if c.Strict {
+			return err
+		}
+		c.warned[pin.Alias] = true
+		c.warnings = append(c.warnings, err.Error())
+		if c.OnWarning != nil {
+			c.OnWarning(err.Error())
+		}
+	}
+	return nil
+}
+
+func (c *Checker) ClaimGPIO(alias Alias, direction Direction) error {
+	pin, ok := LookupHeaderPin(string(alias))
+	if !ok {
+		return fmt.Errorf("unknown header pin %s", alias)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.claim(pin, Mux{Function: FUNC_GPIO}, direction == OUT)
+}
+
+// ClaimFunction claims the pins of a bus, all its signals if none are given.
+// Either all the pins are claimed or none.
+func (c *Checker) ClaimFunction(function Function, instance int, signals ...string) error {
+	pins := FunctionPins(function, instance, signals...)
+	if len(pins) == 0 {
+		return fmt.Errorf("%s%d is not available on the headers", function, instance)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshot := map[Alias]Mux{}
+	for alias, mux := range c.claims {
+		snapshot[alias] = mux
+	}
+	refs := map[Alias]int{}
+	for alias, n := range c.refs {
+		refs[alias] = n
+	}
+	warnings := len(c.warnings)
+	warned := map[Alias]bool{}
+	for alias := range c.warned {
+		warned[alias] = true
+	}
+	for _, pin := range pins {
+		for _, mux := range pin.Functions {
+			if mux.Function != function || mux.Instance != instance {
+				continue
+			}
+			if len(signals) != 0 && !contains(signals, mux.Signal) {
+				continue
+			}
+			if err := c.claim(pin, mux, true); err != nil {
+				c.claims = snapshot
+				c.refs = refs
+				c.warnings = c.warnings[:warnings]
+				c.warned = warned
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Release gives up one claim of the pin
+func (c *Checker) Release(alias Alias) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.release(alias)
+}
+
+// release must be called with the lock held
+func (c *Checker) release(alias Alias) {
+	if c.refs[alias]--; c.refs[alias] <= 0 {
+		delete(c.refs, alias)
+		delete(c.claims, alias)
+	}
+}
+
+// ReleaseFunction gives up the pins claimed by ClaimFunction with the same arguments
+func (c *Checker) ReleaseFunction(function Function, instance int, signals ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, pin := range FunctionPins(function, instance, signals...) {
+		if claimed, ok := c.claims[pin.Alias]; ok && claimed.Function == function && claimed.Instance == instance {
+			c.release(pin.Alias)
+		}
+	}
+}
+
+// checkGPIO checks a new direction of a pin used as gpio without claiming it again
+func (c *Checker) checkGPIO(alias Alias, direction Direction) error {
+	pin, ok := LookupHeaderPin(string(alias))
+	if !ok {
+		return fmt.Errorf("unknown header pin %s", alias)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.check(pin, Mux{Function: FUNC_GPIO}, direction == OUT)
+}
+
+// Warnings returns the BOOTMODE warnings collected so far
+func (c *Checker) Warnings() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.warnings...)
+}
+
+// claimPin records the use of the pin as a gpio in DefaultChecker, false if it was not claimed
+// because the alias is not on the headers
+func claimPin(alias Alias, direction Direction) (bool, error) {
+	if _, ok := LookupHeaderPin(string(alias)); !ok {
+		return false, nil
+	}
+	return true, DefaultChecker.ClaimGPIO(alias, direction)
+}
+
+// checkPinDirection checks the new direction of a pin in DefaultChecker, see claimPin
+func checkPinDirection(alias Alias, direction Direction) error {
+	if _, ok := LookupHeaderPin(string(alias)); !ok {
+		return nil
+	}
+	return DefaultChecker.checkGPIO(alias, direction)
+}
@@ -0,0 +1,74 @@
+package gpio
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHeaderPins(t *testing.T) {
+	pin, ok := LookupHeaderPin("P9_22")
+	if !ok || pin.Alias != P9_22 || !pin.Shared || pin.BootMode != 1 {
+		t.Fatalf("unexpected pin %+v", pin)
+	}
+	if !pin.Supports(Mux{Function: FUNC_PWM, Instance: 0, Signal: "a"}) {
+		t.Error("expected P9_22 to support pwm0.a")
+	}
+	if pins := FunctionPins(FUNC_PWM, 1); len(pins) != 2 || pins[0].Alias != P9_14 || pins[1].Alias != P9_16 {
+		t.Errorf("unexpected pwm1 pins %+v", pins)
+	}
+}
+
+func TestCheckerConflicts(t *testing.T) {
+	checker := NewChecker(false)
+	if err := checker.ClaimFunction(FUNC_PWM, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(checker.Warnings()) != 1 {
+		t.Errorf("expected BOOTMODE1 warning, got %v", checker.Warnings())
+	}
+	var conflict *ConflictError
+	if err := checker.ClaimGPIO(P9_21, IN); !errors.As(err, &conflict) {
+		t.Errorf("expected conflict, got %v", err)
+	}
+	if err := checker.ClaimFunction(FUNC_I2C, 4); !errors.As(err, &conflict) {
+		t.Errorf("expected conflict, got %v", err)
+	}
+	if err := checker.ClaimGPIO(P8_03, OUT); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckerStrictBootMode(t *testing.T) {
+	checker := NewChecker(true)
+	if err := checker.ClaimGPIO(P8_04, IN); err != nil {
+		t.Error(err)
+	}
+	var bootMode *BootModeError
+	if err := checker.ClaimGPIO(P8_04, OUT); !errors.As(err, &bootMode) {
+		t.Errorf("expected boot mode error, got %v", err)
+	}
+	if err := checker.ClaimFunction(FUNC_PWM, 0, "a"); !errors.As(err, &bootMode) {
+		t.Errorf("expected boot mode error, got %v", err)
+	}
+	if err := checker.ClaimFunction(FUNC_PWM, 0, "b"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckerReleaseCounts(t *testing.T) {
+	checker := NewChecker(false)
+	for i := 0; i < 2; i++ {
+		if err := checker.ClaimGPIO(P9_22, IN); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var conflict *ConflictError
+	checker.Release(P9_22)
+	if err := checker.ClaimFunction(FUNC_PWM, 0, "a"); !errors.As(err, &conflict) {
+		t.Errorf("expected the pin to stay claimed by the other gpio, got %v", err)
+	}
+	checker.Release(P9_22)
+	if err := checker.ClaimFunction(FUNC_PWM, 0, "a"); err != nil {
+		t.Errorf("expected the pin to be free: %v", err)
+	}
+}
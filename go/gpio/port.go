@@ -0,0 +1,206 @@
+package gpio
+
+import (
+	"bbai64/registry"
+	"errors"
+	"fmt"
+)
+
+type portDriver interface {
+	values() (uint64, error)
+	setValues(bits uint64, mask uint64) error
+	setDirection(direction Direction) error
+	atomic() bool
+	close() error
+}
+
+// Port drives several pins together as a bitmask, bit i being the i-th alias.
+// With the cdev backend all lines of the same gpiochip are read and written with a single ioctl,
+// so the update is atomic if all the aliases belong to one chip, see Atomic.
+// With the sysfs backend the pins are accessed one after another.
+type Port struct {
+	aliases []Alias
+	drv     portDriver
+}
+
+func NewPort(aliases ...Alias) (*Port, error) {
+	if len(aliases) == 0 || len(aliases) > 64 {
+		return nil, fmt.Errorf("unable to create gpio port: invalid number of pins %d", len(aliases))
+	}
+	seen := map[Alias]bool{}
+	for _, alias := range aliases {
+		if seen[alias] {
+			return nil, fmt.Errorf("unable to create gpio port: %s is used twice", alias)
+		}
+		seen[alias] = true
+	}
+	for i, alias := range aliases {
+		if _, err := claimPin(alias, IN); err != nil {
+			releasePins(aliases[:i])
+			return nil, fmt.Errorf("unable to create gpio port: %w", err)
+		}
+	}
+	var drv portDriver
+	var err error
+	if ActiveBackend() == CDEV {
+		drv, err = newCdevPort(aliases)
+	} else {
+		drv, err = newSysfsPort(aliases)
+	}
+	if err != nil {
+		releasePins(aliases)
+		return nil, err
+	}
+	port := &Port{
+		aliases: append([]Alias(nil), aliases...),
+		drv:     drv,
+	}
+	registry.Register(port)
+	return port, nil
+}
+
+func (p *Port) String() string {
+	return fmt.Sprintf("%v", p.aliases)
+}
+
+func (p *Port) Aliases() []Alias {
+	return append([]Alias(nil), p.aliases...)
+}
+
+// Mask has a bit set for every pin of the port
+func (p *Port) Mask() uint64 {
+	return lineMask(len(p.aliases))
+}
+
+// Atomic tells whether Read and Write access all the pins at once
+func (p *Port) Atomic() bool {
+	return p.drv.atomic()
+}
+
+func (p *Port) Read() (uint64, error) {
+	bits, err := p.drv.values()
+	if err != nil {
+		return 0, fmt.Errorf("unable to read gpio port %s: %w", p, err)
+	}
+	return bits, nil
+}
+
+func (p *Port) Write(bits uint64) error {
+	return p.WriteMasked(bits, p.Mask())
+}
+
+// WriteMasked changes only the pins which have their bit set in mask
+func (p *Port) WriteMasked(bits uint64, mask uint64) error {
+	if err := p.drv.setValues(bits, mask&p.Mask()); err != nil {
+		return fmt.Errorf("unable to write gpio port %s: %w", p, err)
+	}
+	return nil
+}
+
+func (p *Port) SetDirection(direction Direction) error {
+	for _, alias := range p.aliases {
+		if err := checkPinDirection(alias, direction); err != nil {
+			return fmt.Errorf("unable to set gpio port direction for %s: %w", p, err)
+		}
+	}
+	if err := p.drv.setDirection(direction); err != nil {
+		return fmt.Errorf("unable to set gpio port direction for %s: %w", p, err)
+	}
+	return nil
+}
+
+// Close releases all the pins of the port
+func (p *Port) Close() error {
+	registry.Unregister(p)
+	defer releasePins(p.aliases)
+	if err := p.drv.close(); err != nil {
+		return fmt.Errorf("unable to release gpio port %s: %w", p, err)
+	}
+	return nil
+}
+
+// Release closes the port, so the port can be registered as a resource
+func (p *Port) Release() error {
+	return p.Close()
+}
+
+// releasePins gives up the claims of NewPort, the pins of a sysfs port hold none themselves
+func releasePins(aliases []Alias) {
+	for _, alias := range aliases {
+		if _, ok := LookupHeaderPin(string(alias)); ok {
+			DefaultChecker.Release(alias)
+		}
+	}
+}
+
+func lineMask(n int) uint64 {
+	if n >= 64 {
+		return ^uint64(0)
+	}
+	return (1 << n) - 1
+}
+
+type sysfsPort struct {
+	pins []*Pin
+}
+
+func newSysfsPort(aliases []Alias) (*sysfsPort, error) {
+	port := &sysfsPort{}
+	for _, alias := range aliases {
+		pin, err := exportSysfs(alias)
+		if err != nil {
+			port.close()
+			return nil, err
+		}
+		port.pins = append(port.pins, pin)
+	}
+	return port, nil
+}
+
+func (p *sysfsPort) values() (uint64, error) {
+	var bits uint64
+	for i, pin := range p.pins {
+		value, err := pin.drv.value()
+		if err != nil {
+			return 0, err
+		}
+		bits |= uint64(value&1) << i
+	}
+	return bits, nil
+}
+
+func (p *sysfsPort) setValues(bits uint64, mask uint64) error {
+	for i, pin := range p.pins {
+		if mask&(1<<i) == 0 {
+			continue
+		}
+		if err := pin.drv.setValue(Value(bits >> i & 1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *sysfsPort) setDirection(direction Direction) error {
+	for _, pin := range p.pins {
+		if err := pin.drv.setDirection(direction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *sysfsPort) atomic() bool {
+	return len(p.pins) == 1
+}
+
+func (p *sysfsPort) close() error {
+	errs := []error{}
+	for _, pin := range p.pins {
+		if err := pin.Unexport(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	p.pins = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,161 @@
+package gpio_test
+
+import (
+	"bbai64/gpio"
+	"bbai64/hwtest"
+	"bbai64/registry"
+	"bbai64/sysfs"
+	"errors"
+	"testing"
+)
+
+func newSysfsPortTree(t *testing.T) *hwtest.Tree {
+	tree := hwtest.NewTree(t)
+	tree.AddGPIOChip("gpiochip1", "600000.gpio", 425, "", string(gpio.P8_03), string(gpio.P8_04), string(gpio.P8_05))
+	gpio.SetBackend(gpio.SYSFS)
+	gpio.SetFS(tree)
+	t.Cleanup(func() {
+		gpio.SetBackend("")
+		gpio.SetFS(sysfs.Host)
+	})
+	return tree
+}
+
+func TestPortReadWrite(t *testing.T) {
+	tree := newSysfsPortTree(t)
+	port, err := gpio.NewPort(gpio.P8_03, gpio.P8_04, gpio.P8_05)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Close()
+	if port.Mask() != 0b111 || port.Atomic() {
+		t.Errorf("unexpected mask %b or atomic sysfs port", port.Mask())
+	}
+	if err := port.SetDirection(gpio.OUT); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := port.Write(0b101); err != nil {
+		t.Fatal(err)
+	}
+	values := []string{
+		tree.Read("/sys/class/gpio/gpio426/value"),
+		tree.Read("/sys/class/gpio/gpio427/value"),
+		tree.Read("/sys/class/gpio/gpio428/value"),
+	}
+	if values[0] != "1" || values[1] != "0" || values[2] != "1" {
+		t.Errorf("unexpected values %v", values)
+	}
+	if bits, err := port.Read(); err != nil || bits != 0b101 {
+		t.Errorf("unexpected bits %03b: %v", bits, err)
+	}
+
+	// only the pins of the mask are written, bits beyond the port are ignored
+	tree.ResetWrites()
+	if err := port.WriteMasked(0b1010, 0b1110); err != nil {
+		t.Fatal(err)
+	}
+	if writes := tree.Writes(); len(writes) != 2 {
+		t.Errorf("unexpected writes %v", writes)
+	}
+	if bits, err := port.Read(); err != nil || bits != 0b011 {
+		t.Errorf("unexpected bits %03b: %v", bits, err)
+	}
+
+	tree.Set("/sys/class/gpio/gpio428/value", "1\n")
+	if bits, err := port.Read(); err != nil || bits != 0b111 {
+		t.Errorf("unexpected bits %03b: %v", bits, err)
+	}
+}
+
+func TestPortClose(t *testing.T) {
+	tree := newSysfsPortTree(t)
+	if _, err := gpio.NewPort(gpio.P8_03, gpio.P8_03); err == nil {
+		t.Error("expected a pin used twice to be rejected")
+	}
+	port, err := gpio.NewPort(gpio.P8_03, gpio.P8_04)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tree.Exists("/sys/class/gpio/gpio426") || !tree.Exists("/sys/class/gpio/gpio427") {
+		t.Fatal("expected the pins to be exported")
+	}
+	if err := port.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Exists("/sys/class/gpio/gpio426") || tree.Exists("/sys/class/gpio/gpio427") {
+		t.Error("expected the pins to be unexported")
+	}
+	for _, resource := range registry.Resources() {
+		if resource == registry.Resource(port) {
+			t.Error("expected the closed port to be unregistered")
+		}
+	}
+
+	// a port failing on its last pin, missing from the tree, releases the others
+	if _, err := gpio.NewPort(gpio.P8_03, gpio.P8_07); err == nil {
+		t.Error("expected an unknown pin to fail")
+	}
+	if tree.Exists("/sys/class/gpio/gpio426") {
+		t.Error("expected the first pin to be unexported after the failure")
+	}
+}
+
+func TestPinConflicts(t *testing.T) {
+	tree := newSysfsPortTree(t)
+	tree.AddGPIOChip("gpiochip2", "601000.gpio", 400, string(gpio.P9_22))
+	if err := gpio.DefaultChecker.ClaimFunction(gpio.FUNC_PWM, 0, "a"); err != nil {
+		t.Fatal(err)
+	}
+	var conflict *gpio.ConflictError
+	if _, err := gpio.Export(gpio.P9_22); !errors.As(err, &conflict) {
+		t.Errorf("expected conflict with pwm0.a, got %v", err)
+	}
+	if _, err := gpio.NewPort(gpio.P8_03, gpio.P9_22); !errors.As(err, &conflict) {
+		t.Errorf("expected conflict with pwm0.a, got %v", err)
+	}
+	if tree.Exists("/sys/class/gpio/gpio426") {
+		t.Error("expected no pin to be exported after the conflict")
+	}
+
+	gpio.DefaultChecker.ReleaseFunction(gpio.FUNC_PWM, 0, "a")
+	pin, err := gpio.Export(gpio.P9_22)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gpio.DefaultChecker.ClaimFunction(gpio.FUNC_PWM, 0, "a"); !errors.As(err, &conflict) {
+		t.Errorf("expected conflict with the exported gpio, got %v", err)
+	}
+	if err := pin.Unexport(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gpio.DefaultChecker.ClaimFunction(gpio.FUNC_PWM, 0, "a"); err != nil {
+		t.Errorf("expected the unexported pin to be free: %v", err)
+	}
+	gpio.DefaultChecker.ReleaseFunction(gpio.FUNC_PWM, 0, "a")
+}
+
+func TestPortReleasesItsClaimsOnce(t *testing.T) {
+	tree := newSysfsPortTree(t)
+	tree.AddGPIOChip("gpiochip2", "601000.gpio", 400, string(gpio.P9_22))
+	// another user of the pin as gpio in the process
+	if err := gpio.DefaultChecker.ClaimGPIO(gpio.P9_22, gpio.IN); err != nil {
+		t.Fatal(err)
+	}
+	port, err := gpio.NewPort(gpio.P9_22)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := port.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var conflict *gpio.ConflictError
+	if err := gpio.DefaultChecker.ClaimFunction(gpio.FUNC_PWM, 0, "a"); !errors.As(err, &conflict) {
+		t.Errorf("expected the pin to stay claimed by the other user, got %v", err)
+	}
+	gpio.DefaultChecker.Release(gpio.P9_22)
+	if err := gpio.DefaultChecker.ClaimFunction(gpio.FUNC_PWM, 0, "a"); err != nil {
+		t.Errorf("expected the pin to be free: %v", err)
+	}
+	gpio.DefaultChecker.ReleaseFunction(gpio.FUNC_PWM, 0, "a")
+}
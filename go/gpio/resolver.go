@@ -0,0 +1,201 @@
+package gpio
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LineInfo tells where the line named after an alias lives
+type LineInfo struct {
+	Alias  Alias  `json:"alias"`
+	Chip   string `json:"chip"`   // gpiochip device name, e.g. "gpiochip1"
+	Label  string `json:"label"`  // gpiochip label, e.g. "600000.gpio"
+	Offset int    `json:"offset"` // line offset within the gpiochip
+	Number Number `json:"number"` // legacy sysfs number, -1 if the chip is not visible in /sys/class/gpio
+}
+
+type UnknownAliasError struct {
+	Alias Alias
+}
+
+func (e *UnknownAliasError) Error() string {
+	return fmt.Sprintf("unknown gpio alias %q", e.Alias)
+}
+
+type AmbiguousAliasError struct {
+	Alias Alias
+	Lines []LineInfo
+}
+
+func (e *AmbiguousAliasError) Error() string {
+	chips := make([]string, len(e.Lines))
+	for i, line := range e.Lines {
+		chips[i] = fmt.Sprintf("%s:%d", line.Chip, line.Offset)
+	}
+	return fmt.Sprintf("ambiguous gpio alias %q matches %s", e.Alias, strings.Join(chips, ", "))
+}
+
+// Resolver maps aliases to gpio lines without any external tools.
+// Line names are read with the gpiochip info ioctls, falling back to the
+// gpio-line-names device tree property exposed through sysfs.
+// The chips are scanned once and the result is cached until Refresh is called.
+type Resolver struct {
+	root  string
+	mu    sync.Mutex
+	lines map[Alias][]LineInfo
+}
+
+// DefaultResolver is used by Export and GrepNumber
+var DefaultResolver = NewResolver("/")
+
+// NewResolver creates a resolver looking for /dev and /sys under root
+func NewResolver(root string) *Resolver {
+	return &Resolver{root: root}
+}
+
+func (r *Resolver) Root() string {
+	return r.root
+}
+
+// Refresh drops the cached scan, so the next Resolve rescans the chips
+func (r *Resolver) Refresh() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = nil
+}
+
+func (r *Resolver) Resolve(alias Alias) (LineInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lines == nil {
+		lines, err := r.scan()
+		if err != nil {
+			return LineInfo{}, err
+		}
+		r.lines = lines
+	}
+	switch lines := r.lines[alias]; len(lines) {
+	case 0:
+		return LineInfo{}, &UnknownAliasError{Alias: alias}
+	case 1:
+		return lines[0], nil
+	default:
+		return LineInfo{}, &AmbiguousAliasError{Alias: alias, Lines: lines}
+	}
+}
+
+// Lines returns every named line found, ordered by chip and offset
+func (r *Resolver) Lines() ([]LineInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lines == nil {
+		lines, err := r.scan()
+		if err != nil {
+			return nil, err
+		}
+		r.lines = lines
+	}
+	result := []LineInfo{}
+	for _, lines := range r.lines {
+		result = append(result, lines...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Chip != result[j].Chip {
+			return chipIndex(result[i].Chip) < chipIndex(result[j].Chip)
+		}
+		return result[i].Offset < result[j].Offset
+	})
+	return result, nil
+}
+
+func (r *Resolver) path(elem ...string) string {
+	return filepath.Join(append([]string{r.root}, elem...)...)
+}
+
+func (r *Resolver) scan() (map[Alias][]LineInfo, error) {
+	chips, err := filepath.Glob(r.path("sys", "bus", "gpio", "devices", "gpiochip*"))
+	if err != nil {
+		return nil, err
+	}
+	if len(chips) == 0 {
+		return nil, fmt.Errorf("no gpiochips found under %s", r.root)
+	}
+	bases := r.legacyBases()
+	lines := map[Alias][]LineInfo{}
+	for _, chipDir := range chips {
+		chip := filepath.Base(chipDir)
+		label, names, err := readChipLines(r.path("dev", chip))
+		if err != nil {
+			label, names, err = r.readChipLinesSysfs(chipDir)
+			if err != nil {
+				continue
+			}
+		}
+		for offset, name := range names {
+			if name == "" {
+				continue
+			}
+			number := Number(-1)
+			if base, ok := bases[label]; ok {
+				number = Number(base + offset)
+			}
+			alias := Alias(name)
+			lines[alias] = append(lines[alias], LineInfo{
+				Alias:  alias,
+				Chip:   chip,
+				Label:  label,
+				Offset: offset,
+				Number: number,
+			})
+		}
+	}
+	return lines, nil
+}
+
+// readChipLinesSysfs takes the label from the parent device name
+// and the line names from the gpio-line-names device tree property
+func (r *Resolver) readChipLinesSysfs(chipDir string) (string, []string, error) {
+	device, err := filepath.EvalSymlinks(chipDir)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(device, "of_node", "gpio-line-names"))
+	if err != nil {
+		return "", nil, err
+	}
+	names := strings.Split(string(bytes.TrimRight(data, "\x00")), "\x00")
+	return filepath.Base(filepath.Dir(device)), names, nil
+}
+
+// legacyBases maps gpiochip labels to their /sys/class/gpio base numbers
+func (r *Resolver) legacyBases() map[string]int {
+	bases := map[string]int{}
+	labels, _ := filepath.Glob(r.path("sys", "class", "gpio", "gpiochip*", "label"))
+	for _, label := range labels {
+		data, err := os.ReadFile(label)
+		if err != nil {
+			continue
+		}
+		base, err := os.ReadFile(filepath.Join(filepath.Dir(label), "base"))
+		if err != nil {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimSpace(string(base)))
+		if err != nil {
+			continue
+		}
+		bases[strings.TrimSpace(string(data))] = number
+	}
+	return bases
+}
+
+func chipIndex(chip string) int {
+	index, _ := strconv.Atoi(strings.TrimPrefix(chip, "gpiochip"))
+	return index
+}
@@ -0,0 +1,83 @@
+package gpio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func writeFakeChip(t *testing.T, root string, chip string, label string, base int, names ...string) {
+	device := filepath.Join(root, "sys", "devices", "platform", "bus@100000", label)
+	if err := os.MkdirAll(filepath.Join(device, chip, "of_node"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	lineNames := strings.Join(names, "\x00") + "\x00"
+	if err := os.WriteFile(filepath.Join(device, chip, "of_node", "gpio-line-names"), []byte(lineNames), 0644); err != nil {
+		t.Fatal(err)
+	}
+	devices := filepath.Join(root, "sys", "bus", "gpio", "devices")
+	if err := os.MkdirAll(devices, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(device, chip), filepath.Join(devices, chip)); err != nil {
+		t.Fatal(err)
+	}
+	if base < 0 {
+		return
+	}
+	legacy := filepath.Join(root, "sys", "class", "gpio", "gpiochip"+strconv.Itoa(base))
+	if err := os.MkdirAll(legacy, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(legacy, "label"), []byte(label+"\n"), 0644)
+	os.WriteFile(filepath.Join(legacy, "base"), []byte(strconv.Itoa(base)+"\n"), 0644)
+}
+
+func TestResolverResolve(t *testing.T) {
+	root := t.TempDir()
+	writeFakeChip(t, root, "gpiochip0", "42110000.gpio", -1, "", "P9_17B")
+	writeFakeChip(t, root, "gpiochip1", "600000.gpio", 4, "", string(P8_03), string(P8_04), "P9_17B")
+
+	resolver := NewResolver(root)
+	line, err := resolver.Resolve(P8_04)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line.Chip != "gpiochip1" || line.Label != "600000.gpio" || line.Offset != 2 || line.Number != 6 {
+		t.Errorf("unexpected line %+v", line)
+	}
+
+	var unknown *UnknownAliasError
+	if _, err := resolver.Resolve(P9_42); !errors.As(err, &unknown) {
+		t.Errorf("expected UnknownAliasError, got %v", err)
+	}
+	var ambiguous *AmbiguousAliasError
+	if _, err := resolver.Resolve("P9_17B"); !errors.As(err, &ambiguous) || len(ambiguous.Lines) != 2 {
+		t.Errorf("expected AmbiguousAliasError, got %v", err)
+	}
+}
+
+func TestResolverCache(t *testing.T) {
+	root := t.TempDir()
+	writeFakeChip(t, root, "gpiochip1", "600000.gpio", -1, string(P8_03))
+
+	resolver := NewResolver(root)
+	line, err := resolver.Resolve(P8_03)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line.Number != -1 {
+		t.Errorf("expected unknown sysfs number, got %d", line.Number)
+	}
+	os.RemoveAll(filepath.Join(root, "sys"))
+	if _, err := resolver.Resolve(P8_03); err != nil {
+		t.Errorf("expected cached result, got %v", err)
+	}
+	resolver.Refresh()
+	if _, err := resolver.Resolve(P8_03); err == nil {
+		t.Error("expected rescan to fail after refresh")
+	}
+}
@@ -0,0 +1,68 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SafeState is the state a pin is put back into when it is released.
+// Value only applies to outputs and Edge only to inputs.
+type SafeState struct {
+	Direction Direction `json:"direction"`
+	Value     Value     `json:"value"`
+	Edge      Edge      `json:"edge"`
+}
+
+// SetSafeState declares the state Release restores, e.g. an input for a pin driving a motor driver.
+// Without it Release only unexports the pin.
+func (p *Pin) SetSafeState(state SafeState) {
+	p.safe = &state
+}
+
+func (p *Pin) SafeState() (SafeState, bool) {
+	if p.safe == nil {
+		return SafeState{}, false
+	}
+	return *p.safe, true
+}
+
+// Release restores the safe state and unexports the pin.
+// Every exported pin is released by registry.ReleaseAll, on a signal or a panic.
+func (p *Pin) Release() error {
+	var errs []error
+	if p.safe != nil {
+		if err := p.restore(*p.safe); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := p.Unexport(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Pin) restore(state SafeState) error {
+	if state.Direction == OUT {
+		if err := p.SetEdge(NONE); err != nil {
+			return fmt.Errorf("unable to restore safe state of gpio %s: %w", p, err)
+		}
+		if err := p.SetDirection(OUT); err != nil {
+			return fmt.Errorf("unable to restore safe state of gpio %s: %w", p, err)
+		}
+		if err := p.SetValue(state.Value); err != nil {
+			return fmt.Errorf("unable to restore safe state of gpio %s: %w", p, err)
+		}
+		return nil
+	}
+	if err := p.SetDirection(IN); err != nil {
+		return fmt.Errorf("unable to restore safe state of gpio %s: %w", p, err)
+	}
+	edge := state.Edge
+	if edge == "" {
+		edge = NONE
+	}
+	if err := p.SetEdge(edge); err != nil {
+		return fmt.Errorf("unable to restore safe state of gpio %s: %w", p, err)
+	}
+	return nil
+}
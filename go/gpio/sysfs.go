@@ -0,0 +1,145 @@
+package gpio
+
+import (
+	"bbai64/sysfs"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type sysfsDriver struct {
+	fs            sysfs.FS
+	number        int
+	directionPath string
+	edgePath      string
+	buff          []byte
+	f             sysfs.File
+	seqno         uint32
+}
+
+func (d *sysfsDriver) setBias(bias Bias) error {
+	if bias == AS_IS {
+		return nil
+	}
+	return fmt.Errorf("bias is %w by the sysfs backend", ErrUnsupported)
+}
+
+func (d *sysfsDriver) setDrive(drive Drive) error {
+	if drive == PUSH_PULL {
+		return nil
+	}
+	return fmt.Errorf("drive is %w by the sysfs backend", ErrUnsupported)
+}
+
+func (d *sysfsDriver) setActiveLow(activeLow bool) error {
+	value := []byte{'0'}
+	if activeLow {
+		value[0] = '1'
+	}
+	return d.fs.WriteFile(fmt.Sprintf("/sys/class/gpio/gpio%d/active_low", d.number), value)
+}
+
+func (d *sysfsDriver) watchFd() (int, bool) {
+	return int(d.f.Fd()), true
+}
+
+// arm reads the value once, so poll() only reports edges from now on
+func (d *sysfsDriver) arm() error {
+	_, err := d.value()
+	return err
+}
+
+// readEvents reads the value which also acknowledges the notification,
+// sysfs does not tell the edge so it is deduced from the new value
+func (d *sysfsDriver) readEvents(events []Event) ([]Event, error) {
+	timestamp := monotonicNow()
+	value, err := d.value()
+	if err != nil {
+		return events, err
+	}
+	edge := FALLING
+	if value == HIGH {
+		edge = RISING
+	}
+	d.seqno++
+	return append(events, Event{Edge: edge, Timestamp: timestamp, Seqno: d.seqno}), nil
+}
+
+func (d *sysfsDriver) value() (Value, error) {
+	d.f.Seek(0, 0)
+	_, err := d.f.Read(d.buff)
+	if err != nil {
+		return LOW, err
+	}
+	value, err := strconv.Atoi(string(d.buff))
+	if err != nil {
+		return LOW, err
+	}
+	return Value(value), nil
+}
+
+func (d *sysfsDriver) setValue(value Value) error {
+	d.buff[0] = byte(value) + '0'
+	_, err := d.f.Write(d.buff)
+	return err
+}
+
+func (d *sysfsDriver) direction() (Direction, error) {
+	data, err := d.fs.ReadFile(d.directionPath)
+	if err != nil {
+		return IN, err
+	}
+	return Direction(strings.TrimSpace(string(data))), nil
+}
+
+func (d *sysfsDriver) setDirection(direction Direction) error {
+	return d.fs.WriteFile(d.directionPath, []byte(direction))
+}
+
+func (d *sysfsDriver) edge() (Edge, error) {
+	data, err := d.fs.ReadFile(d.edgePath)
+	if err != nil {
+		return NONE, err
+	}
+	return Edge(strings.TrimSpace(string(data))), nil
+}
+
+func (d *sysfsDriver) setEdge(edge Edge) error {
+	return d.fs.WriteFile(d.edgePath, []byte(edge))
+}
+
+func (d *sysfsDriver) close() error {
+	d.f.Close()
+	value := fmt.Sprintf("%d", d.number)
+	return d.fs.WriteFile("/sys/class/gpio/unexport", []byte(value))
+}
+
+func exportSysfs(alias Alias) (*Pin, error) {
+	number, err := GrepNumber(alias)
+	if err != nil {
+		return nil, err
+	}
+	value := fmt.Sprintf("%d", number)
+	fs := fsRoot
+	if err := fs.WriteFile("/sys/class/gpio/export", []byte(value)); err != nil {
+		return nil, fmt.Errorf("unable to export gpio %s: %w", alias, err)
+	}
+	file, err := fs.OpenFile(fmt.Sprintf("/sys/class/gpio/gpio%d/value", number), os.O_RDWR)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open gpio %s: %w", alias, err)
+	}
+	return &Pin{
+		number: Number(number),
+		alias:  alias,
+		offset: -1,
+		drv: &sysfsDriver{
+			fs:            fs,
+			number:        number,
+			f:             file,
+			buff:          make([]byte, 1),
+			directionPath: fmt.Sprintf("/sys/class/gpio/gpio%d/direction", number),
+			edgePath:      fmt.Sprintf("/sys/class/gpio/gpio%d/edge", number),
+		},
+	}, nil
+}
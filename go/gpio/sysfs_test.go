@@ -0,0 +1,125 @@
+package gpio_test
+
+import (
+	"bbai64/gpio"
+	"bbai64/hwtest"
+	"bbai64/registry"
+	"bbai64/sysfs"
+	"errors"
+	"testing"
+)
+
+func TestSysfsExport(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddGPIOChip("gpiochip1", "600000.gpio", 425, "", string(gpio.P8_03), string(gpio.P8_04))
+	gpio.SetBackend(gpio.SYSFS)
+	gpio.SetFS(tree)
+	defer gpio.SetBackend("")
+	defer gpio.SetFS(sysfs.Host)
+
+	pin, err := gpio.Export(gpio.P8_04)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Number() != 427 {
+		t.Errorf("unexpected gpio number %d", pin.Number())
+	}
+	if err := pin.SetValue(gpio.HIGH); err == nil {
+		t.Error("expected an input to reject values")
+	}
+	if err := pin.SetDirection(gpio.OUT); err != nil {
+		t.Fatal(err)
+	}
+	if direction, err := pin.Direction(); err != nil || direction != gpio.OUT {
+		t.Errorf("unexpected direction %q: %v", direction, err)
+	}
+	if err := pin.SetValue(gpio.HIGH); err != nil {
+		t.Fatal(err)
+	}
+	if value := tree.Read("/sys/class/gpio/gpio427/value"); value != "1" {
+		t.Errorf("unexpected value %q", value)
+	}
+	tree.Set("/sys/class/gpio/gpio427/value", "0\n")
+	if value, err := pin.Value(); err != nil || value != gpio.LOW {
+		t.Errorf("unexpected value %d: %v", value, err)
+	}
+	if err := pin.Unexport(); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Exists("/sys/class/gpio/gpio427") {
+		t.Error("expected gpio427 to be unexported")
+	}
+	if writes := tree.WritesTo("/sys/class/gpio/export"); len(writes) != 1 || writes[0] != "427" {
+		t.Errorf("unexpected exports %v", writes)
+	}
+}
+
+func TestSysfsOptions(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddGPIOChip("gpiochip1", "600000.gpio", 425, "", string(gpio.P8_03))
+	gpio.SetBackend(gpio.SYSFS)
+	gpio.SetFS(tree)
+	defer gpio.SetBackend("")
+	defer gpio.SetFS(sysfs.Host)
+
+	pin, err := gpio.Export(gpio.P8_03, gpio.WithActiveLow())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := tree.Read("/sys/class/gpio/gpio426/active_low"); value != "1" {
+		t.Errorf("unexpected active_low %q", value)
+	}
+	if s := pin.String(); s != `426 "P8_03" (active-low)` {
+		t.Errorf("unexpected string %s", s)
+	}
+	if err := pin.SetBias(gpio.PULL_UP); !errors.Is(err, gpio.ErrUnsupported) {
+		t.Errorf("expected bias to be unsupported, got %v", err)
+	}
+	if pin.Bias() != gpio.AS_IS {
+		t.Errorf("unexpected bias %q", pin.Bias())
+	}
+	pin.Unexport()
+
+	if _, err := gpio.Export(gpio.P8_03, gpio.WithDrive(gpio.OPEN_DRAIN)); !errors.Is(err, gpio.ErrUnsupported) {
+		t.Errorf("expected drive to be unsupported, got %v", err)
+	}
+	if tree.Exists("/sys/class/gpio/gpio426") {
+		t.Error("expected the pin to be unexported after a failed option")
+	}
+}
+
+func TestSysfsReleaseAll(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddGPIOChip("gpiochip1", "600000.gpio", 425, "", string(gpio.P8_03), string(gpio.P8_04))
+	gpio.SetBackend(gpio.SYSFS)
+	gpio.SetFS(tree)
+	defer gpio.SetBackend("")
+	defer gpio.SetFS(sysfs.Host)
+
+	led, err := gpio.Export(gpio.P8_03)
+	if err != nil {
+		t.Fatal(err)
+	}
+	led.SetSafeState(gpio.SafeState{Direction: gpio.OUT, Value: gpio.LOW})
+	led.SetDirection(gpio.OUT)
+	led.SetValue(gpio.HIGH)
+	button, err := gpio.Export(gpio.P8_04)
+	if err != nil {
+		t.Fatal(err)
+	}
+	button.SetSafeState(gpio.SafeState{Direction: gpio.IN})
+	button.SetEdge(gpio.BOTH)
+
+	if err := registry.ReleaseAll(); err != nil {
+		t.Fatal(err)
+	}
+	if values := tree.WritesTo("/sys/class/gpio/gpio426/value"); len(values) != 2 || values[1] != "0" {
+		t.Errorf("expected the led to be turned off, got %v", values)
+	}
+	if edges := tree.WritesTo("/sys/class/gpio/gpio427/edge"); len(edges) != 2 || edges[1] != "none" {
+		t.Errorf("expected the button edge to be reset, got %v", edges)
+	}
+	if tree.Exists("/sys/class/gpio/gpio426") || tree.Exists("/sys/class/gpio/gpio427") {
+		t.Error("expected both pins to be unexported")
+	}
+}
@@ -0,0 +1,304 @@
+package gpio
+
+/*
+#ifndef GPIO_WATCHER_H_
+#define GPIO_WATCHER_H_
+
+#cgo CFLAGS: -std=gnu99
+#cgo CXXFLAGS: -std=gnu99
+
+#include <poll.h>
+#include <time.h>
+
+int GpioPollFds(struct pollfd *fds, int n)
+{
+	return poll(fds, n, -1);
+}
+
+long long GpioMonotonicNs()
+{
+	struct timespec ts;
+	clock_gettime(CLOCK_MONOTONIC, &ts);
+	return (long long)ts.tv_sec * 1000000000LL + ts.tv_nsec;
+}
+
+#endif // GPIO_WATCHER_H_
+*/
+import "C"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// EVENTS_BUFFER_SIZE is the capacity of the channels returned by Pin.Events.
+// Events are dropped if a consumer falls behind, which shows up as a gap in Seqno.
+const EVENTS_BUFFER_SIZE = 64
+
+var errEventsClosed = errors.New("event stream closed")
+
+type Event struct {
+	Edge      Edge          `json:"edge"`      // RISING or FALLING
+	Timestamp time.Duration `json:"timestamp"` // CLOCK_MONOTONIC time the edge was detected at
+	Seqno     uint32        `json:"seqno"`     // per pin sequence number, gaps mean missed events
+}
+
+func monotonicNow() time.Duration {
+	return time.Duration(C.GpioMonotonicNs())
+}
+
+// Now returns the CLOCK_MONOTONIC time, to compare with Event.Timestamp
+func Now() time.Duration {
+	return monotonicNow()
+}
+
+// pollFds waits for the pollfd array of n entries, it is replaced in tests
+var pollFds = func(fds unsafe.Pointer, n int) error {
+	if r, err := C.GpioPollFds((*C.struct_pollfd)(fds), C.int(n)); r < 0 {
+		return err
+	}
+	return nil
+}
+
+type subscription struct {
+	c    chan Event
+	stop func() bool
+}
+
+type watchEntry struct {
+	pin  *Pin
+	subs map[*subscription]struct{}
+}
+
+// watcher waits for the edges of all subscribed pins with a single poll() call
+// in a single goroutine, which exits as soon as nothing is subscribed.
+type watcher struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	entries    map[*Pin]*watchEntry
+	running    bool
+	generation uint64 // bumped every time the set of polled pins changes
+	synced     uint64 // generation the poll loop is currently waiting on
+	wakeR      int
+	wakeW      int
+}
+
+var defaultWatcher = newWatcher()
+
+func newWatcher() *watcher {
+	w := &watcher{
+		entries: map[*Pin]*watchEntry{},
+		wakeR:   -1,
+		wakeW:   -1,
+	}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+func (w *watcher) subscribe(ctx context.Context, pin *Pin) (<-chan Event, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.wakeR < 0 {
+		fds := make([]int, 2)
+		if err := syscall.Pipe(fds); err != nil {
+			return nil, err
+		}
+		syscall.SetNonblock(fds[0], true)
+		syscall.SetNonblock(fds[1], true)
+		w.wakeR, w.wakeW = fds[0], fds[1]
+	}
+	entry, ok := w.entries[pin]
+	if !ok {
+		if err := pin.drv.arm(); err != nil {
+			return nil, err
+		}
+		entry = &watchEntry{pin: pin, subs: map[*subscription]struct{}{}}
+		w.entries[pin] = entry
+		w.changed()
+	}
+	sub := &subscription{c: make(chan Event, EVENTS_BUFFER_SIZE)}
+	entry.subs[sub] = struct{}{}
+	sub.stop = context.AfterFunc(ctx, func() {
+		w.unsubscribe(entry, sub)
+	})
+	if !w.running {
+		w.running = true
+		go w.loop()
+	}
+	return sub.c, nil
+}
+
+func (w *watcher) unsubscribe(entry *watchEntry, sub *subscription) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := entry.subs[sub]; !ok {
+		return
+	}
+	delete(entry.subs, sub)
+	close(sub.c)
+	if len(entry.subs) == 0 && w.entries[entry.pin] == entry {
+		delete(w.entries, entry.pin)
+		w.changed()
+	}
+}
+
+// remove closes all event streams of the pin and waits until it is no longer polled,
+// so its file descriptor can be safely closed
+func (w *watcher) remove(pin *Pin) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	entry, ok := w.entries[pin]
+	if !ok {
+		return
+	}
+	w.closeEntry(entry)
+	generation := w.changed()
+	for w.running && w.synced < generation {
+		w.cond.Wait()
+	}
+}
+
+func (w *watcher) closeEntry(entry *watchEntry) {
+	for sub := range entry.subs {
+		sub.stop()
+		close(sub.c)
+	}
+	entry.subs = nil
+	delete(w.entries, entry.pin)
+}
+
+// changed must be called with the lock held
+func (w *watcher) changed() uint64 {
+	w.generation++
+	if w.wakeW >= 0 {
+		syscall.Write(w.wakeW, []byte{0})
+	}
+	return w.generation
+}
+
+func (w *watcher) loop() {
+	pfds := []C.struct_pollfd{}
+	entries := []*watchEntry{}
+	events := make([]Event, 0, EVENTS_BUFFER_SIZE)
+	drain := make([]byte, 64)
+	for {
+		w.mu.Lock()
+		w.synced = w.generation
+		w.cond.Broadcast()
+		if len(w.entries) == 0 {
+			w.running = false
+			w.mu.Unlock()
+			return
+		}
+		pfds = append(pfds[:0], C.struct_pollfd{fd: C.int(w.wakeR), events: C.POLLIN})
+		entries = entries[:0]
+		for _, entry := range w.entries {
+			fd, priority := entry.pin.drv.watchFd()
+			pfd := C.struct_pollfd{fd: C.int(fd), events: C.POLLIN}
+			if priority {
+				pfd.events = C.POLLPRI | C.POLLERR
+			}
+			pfds = append(pfds, pfd)
+			entries = append(entries, entry)
+		}
+		w.mu.Unlock()
+
+		if err := pollFds(unsafe.Pointer(&pfds[0]), len(pfds)); err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			// retrying would spin on the same error, the streams are closed as if reading failed
+			log.Print("Could not poll gpio events: ", err)
+			w.fail(entries)
+			continue
+		}
+		if pfds[0].revents != 0 {
+			for {
+				if n, _ := syscall.Read(w.wakeR, drain); n <= 0 {
+					break
+				}
+			}
+		}
+		for i, entry := range entries {
+			revents := pfds[i+1].revents
+			if revents == 0 || revents&C.POLLNVAL != 0 {
+				continue
+			}
+			var err error
+			events, err = entry.pin.drv.readEvents(events[:0])
+			w.dispatch(entry, events, err)
+		}
+	}
+}
+
+// fail closes the event streams of the entries which are still watched
+func (w *watcher) fail(entries []*watchEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, entry := range entries {
+		if w.entries[entry.pin] == entry {
+			w.closeEntry(entry)
+		}
+	}
+	w.changed()
+}
+
+func (w *watcher) dispatch(entry *watchEntry, events []Event, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.entries[entry.pin] != entry {
+		return
+	}
+	if err != nil {
+		w.closeEntry(entry)
+		w.changed()
+		return
+	}
+	for sub := range entry.subs {
+		for _, event := range events {
+			select {
+			case sub.c <- event:
+			default:
+			}
+		}
+	}
+}
+
+// Events streams the edges detected on the pin, as configured with SetEdge.
+// The channel is closed when ctx is done, the pin is unexported or reading fails.
+// All pins share a single polling goroutine.
+func (p *Pin) Events(ctx context.Context) (<-chan Event, error) {
+	events, err := defaultWatcher.subscribe(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("unable to watch gpio %s: %w", p, err)
+	}
+	return events, nil
+}
+
+// WaitForEdge blocks until the next edge or until ctx is done,
+// use context.WithTimeout to wait for a limited time
+func (p *Pin) WaitForEdge(ctx context.Context) (Event, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := p.Events(ctx)
+	if err != nil {
+		return Event{}, err
+	}
+	select {
+	case event, ok := <-events:
+		if !ok {
+			if ctx.Err() != nil {
+				return Event{}, ctx.Err()
+			}
+			return Event{}, fmt.Errorf("unable to wait for gpio edge of %s: %w", p, errEventsClosed)
+		}
+		return event, nil
+	case <-ctx.Done():
+		return Event{}, ctx.Err()
+	}
+}
@@ -0,0 +1,170 @@
+package gpio
+
+import (
+	"context"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// pipeDriver reports one rising edge for every byte written to its pipe
+type pipeDriver struct {
+	r, w  int
+	seqno uint32
+}
+
+func newPipeDriver(t *testing.T) *pipeDriver {
+	fds := make([]int, 2)
+	if err := syscall.Pipe(fds); err != nil {
+		t.Fatal(err)
+	}
+	syscall.SetNonblock(fds[0], true)
+	return &pipeDriver{r: fds[0], w: fds[1]}
+}
+
+func (d *pipeDriver) value() (Value, error)                  { return HIGH, nil }
+func (d *pipeDriver) setValue(value Value) error             { return nil }
+func (d *pipeDriver) direction() (Direction, error)          { return IN, nil }
+func (d *pipeDriver) setDirection(direction Direction) error { return nil }
+func (d *pipeDriver) edge() (Edge, error)                    { return RISING, nil }
+func (d *pipeDriver) setEdge(edge Edge) error                { return nil }
+func (d *pipeDriver) setBias(bias Bias) error                { return nil }
+func (d *pipeDriver) setDrive(drive Drive) error             { return nil }
+func (d *pipeDriver) setActiveLow(activeLow bool) error      { return nil }
+func (d *pipeDriver) watchFd() (int, bool)                   { return d.r, false }
+func (d *pipeDriver) arm() error                             { return nil }
+
+func (d *pipeDriver) readEvents(events []Event) ([]Event, error) {
+	buff := make([]byte, 16)
+	n, err := syscall.Read(d.r, buff)
+	if err != nil {
+		return events, err
+	}
+	for i := 0; i < n; i++ {
+		d.seqno++
+		events = append(events, Event{Edge: RISING, Timestamp: monotonicNow(), Seqno: d.seqno})
+	}
+	return events, nil
+}
+
+func (d *pipeDriver) close() error {
+	syscall.Close(d.w)
+	return syscall.Close(d.r)
+}
+
+func TestPinEvents(t *testing.T) {
+	drv := newPipeDriver(t)
+	pin := &Pin{alias: P8_03, number: 1, drv: drv}
+	defer pin.Unexport()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	events, err := pin.Events(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syscall.Write(drv.w, []byte{1, 1})
+	for seqno := uint32(1); seqno <= 2; seqno++ {
+		select {
+		case event := <-events:
+			if event.Edge != RISING || event.Seqno != seqno || event.Timestamp <= 0 {
+				t.Errorf("unexpected event %+v", event)
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for event")
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestWaitForEdgeTimeout(t *testing.T) {
+	pin := &Pin{alias: P8_04, number: 2, drv: newPipeDriver(t)}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pin.WaitForEdge(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if err := pin.Unexport(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUnexportClosesEvents(t *testing.T) {
+	pin := &Pin{alias: P8_05, number: 3, drv: newPipeDriver(t)}
+	events, err := pin.Events(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin.Unexport()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("expected closed channel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event stream was not closed")
+	}
+}
+
+func replacePollFds(t *testing.T, poll func(fds unsafe.Pointer, n int) error) {
+	original := pollFds
+	pollFds = poll
+	t.Cleanup(func() { pollFds = original })
+}
+
+func TestPollRetriesOnEINTR(t *testing.T) {
+	real := pollFds
+	var calls atomic.Int32
+	replacePollFds(t, func(fds unsafe.Pointer, n int) error {
+		if calls.Add(1) == 1 {
+			return syscall.EINTR
+		}
+		return real(fds, n)
+	})
+	drv := newPipeDriver(t)
+	pin := &Pin{alias: P8_03, number: 1, drv: drv}
+	defer pin.Unexport()
+	events, err := pin.Events(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	syscall.Write(drv.w, []byte{1})
+	select {
+	case event := <-events:
+		if event.Seqno != 1 {
+			t.Errorf("unexpected event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event after EINTR")
+	}
+}
+
+func TestPollErrorClosesEvents(t *testing.T) {
+	var calls atomic.Int32
+	replacePollFds(t, func(fds unsafe.Pointer, n int) error {
+		calls.Add(1)
+		return syscall.EINVAL
+	})
+	pin := &Pin{alias: P8_04, number: 2, drv: newPipeDriver(t)}
+	defer pin.Unexport()
+	events, err := pin.Events(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("expected closed channel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event stream was not closed after the poll error")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected the poll error not to be retried, polled %d times", n)
+	}
+}
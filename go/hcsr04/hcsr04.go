@@ -0,0 +1,153 @@
+package hcsr04
+
+import (
+	"bbai64/gpio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// based on: https://cdn.sparkfun.com/datasheets/Sensors/Proximity/HCSR04.pdf
+// The echo output is 5V, use a voltage divider to bring it down to 3.3V.
+
+const TRIGGER_PULSE = 10 * time.Microsecond
+const ECHO_TIMEOUT = 40 * time.Millisecond      // the sensor gives up after 38ms without an obstacle
+const MEASUREMENT_CYCLE = 60 * time.Millisecond // minimum time between two triggers
+const DISTANCE_MIN float64 = 0.02
+const DISTANCE_MAX float64 = 4.0
+const TEMPERATURE_DEFAULT float64 = 20
+
+var ErrNoEcho = errors.New("no echo")
+var ErrImplausible = errors.New("implausible reading")
+
+// SpeedOfSound returns the speed of sound in dry air in m/s
+func SpeedOfSound(celsius float64) float64 {
+	return 331.3 * math.Sqrt(1+celsius/273.15)
+}
+
+// Distance converts the echo pulse width to meters, the sound travels there and back
+func Distance(pulse time.Duration, celsius float64) float64 {
+	return pulse.Seconds() * SpeedOfSound(celsius) / 2
+}
+
+type HCSR04 struct {
+	mu          sync.Mutex
+	trigger     *gpio.Pin
+	echo        *gpio.Pin
+	temperature float64
+	lastTrigger time.Time
+}
+
+// New configures the trigger pin as an output and the echo pin as an input reporting both edges.
+// The echo pin must be exported with the cdev backend, the pulse is measured from the kernel timestamps.
+func New(trigger *gpio.Pin, echo *gpio.Pin) (*HCSR04, error) {
+	if echo.Backend() != gpio.CDEV {
+		return nil, fmt.Errorf("unable to use gpio %s as echo: %w", echo, gpio.ErrUserspaceTimestamps)
+	}
+	if err := trigger.SetDirection(gpio.OUT); err != nil {
+		return nil, err
+	}
+	if err := trigger.SetValue(gpio.LOW); err != nil {
+		return nil, err
+	}
+	if err := echo.SetDirection(gpio.IN); err != nil {
+		return nil, err
+	}
+	if err := echo.SetEdge(gpio.BOTH); err != nil {
+		return nil, err
+	}
+	return &HCSR04{
+		trigger:     trigger,
+		echo:        echo,
+		temperature: TEMPERATURE_DEFAULT,
+	}, nil
+}
+
+// SetTemperature sets the air temperature in °C used to compensate the speed of sound
+func (h *HCSR04) SetTemperature(celsius float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.temperature = celsius
+}
+
+// Measure fires a trigger pulse and returns the distance in meters from the echo pulse timestamps.
+// It returns ErrNoEcho if no pulse ends within ECHO_TIMEOUT
+// and ErrImplausible if the distance is out of the range of the sensor.
+func (h *HCSR04) Measure(ctx context.Context) (float64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if wait := MEASUREMENT_CYCLE - time.Since(h.lastTrigger); wait > 0 {
+		time.Sleep(wait)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ECHO_TIMEOUT)
+	defer cancel()
+	events, err := h.echo.Events(ctx)
+	if err != nil {
+		return 0, err
+	}
+	h.lastTrigger = time.Now()
+	if err := h.trigger.SetValue(gpio.HIGH); err != nil {
+		return 0, err
+	}
+	time.Sleep(TRIGGER_PULSE)
+	if err := h.trigger.SetValue(gpio.LOW); err != nil {
+		return 0, err
+	}
+
+	var start time.Duration
+	for event := range events {
+		if event.Edge == gpio.RISING {
+			start = event.Timestamp
+			continue
+		}
+		if start == 0 {
+			continue
+		}
+		distance := Distance(event.Timestamp-start, h.temperature)
+		if distance < DISTANCE_MIN || distance > DISTANCE_MAX {
+			return distance, fmt.Errorf("%w: %.3f m", ErrImplausible, distance)
+		}
+		return distance, nil
+	}
+	if err := ctx.Err(); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return 0, err
+	}
+	return 0, ErrNoEcho
+}
+
+// MeasureMedian takes a number of samples and returns the median of the plausible ones,
+// which filters out the occasional spurious echo
+func (h *HCSR04) MeasureMedian(ctx context.Context, samples int) (float64, error) {
+	distances := []float64{}
+	var lastErr error
+	for i := 0; i < samples; i++ {
+		distance, err := h.Measure(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		distances = append(distances, distance)
+	}
+	if len(distances) == 0 {
+		return 0, lastErr
+	}
+	return Median(distances), nil
+}
+
+func Median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
@@ -0,0 +1,56 @@
+package hcsr04
+
+import (
+	"bbai64/gpio"
+	"bbai64/hwtest"
+	"bbai64/sysfs"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDistance(t *testing.T) {
+	if speed := SpeedOfSound(20); math.Abs(speed-343.2) > 0.1 {
+		t.Errorf("unexpected speed of sound %f", speed)
+	}
+	if distance := Distance(5830*time.Microsecond, 20); math.Abs(distance-1) > 0.001 {
+		t.Errorf("unexpected distance %f", distance)
+	}
+	if cold, warm := Distance(time.Millisecond, -10), Distance(time.Millisecond, 30); cold >= warm {
+		t.Errorf("expected sound to travel further in warm air, %f >= %f", cold, warm)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	if median := Median([]float64{0.5, 3.9, 0.52}); median != 0.52 {
+		t.Errorf("unexpected median %f", median)
+	}
+	if median := Median([]float64{1, 0.5, 0.6, 2}); median != 0.8 {
+		t.Errorf("unexpected median %f", median)
+	}
+}
+
+func TestNewRequiresCdev(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddGPIOChip("gpiochip1", "600000.gpio", 425, "", string(gpio.P8_03), string(gpio.P8_04))
+	gpio.SetBackend(gpio.SYSFS)
+	gpio.SetFS(tree)
+	t.Cleanup(func() {
+		gpio.SetBackend("")
+		gpio.SetFS(sysfs.Host)
+	})
+	trigger, err := gpio.Export(gpio.P8_03)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trigger.Release()
+	echo, err := gpio.Export(gpio.P8_04)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Release()
+	if _, err := New(trigger, echo); !errors.Is(err, gpio.ErrUserspaceTimestamps) {
+		t.Errorf("expected the sysfs echo to be rejected, got %v", err)
+	}
+}
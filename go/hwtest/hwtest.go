@@ -0,0 +1,335 @@
+package hwtest
+
+import (
+	"bbai64/sysfs"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// Write is a write made through the tree, Err is what the simulated kernel answered
+type Write struct {
+	Path string
+	Data string
+	Err  error
+}
+
+// Tree is a fake /sys and /dev in a temporary directory, it implements sysfs.FS.
+// Writes to the gpio and pwm attributes follow the kernel semantics:
+// export creates the gpioN directory, values can't be written to inputs,
+// duty_cycle can't exceed period, polarity can't change while enabled, and so on.
+type Tree struct {
+	t      testing.TB
+	root   string
+	mu     sync.Mutex
+	lines  map[int]bool
+	writes []Write
+}
+
+func NewTree(t testing.TB) *Tree {
+	tree := &Tree{
+		t:     t,
+		root:  t.TempDir(),
+		lines: map[int]bool{},
+	}
+	tree.mkdir("/sys/class/gpio")
+	tree.Set("/sys/class/gpio/export", "")
+	tree.Set("/sys/class/gpio/unexport", "")
+	return tree
+}
+
+func (t *Tree) Root() string {
+	return t.root
+}
+
+func (t *Tree) path(name string) string {
+	return filepath.Join(t.root, name)
+}
+
+func (t *Tree) mkdir(name string) {
+	if err := os.MkdirAll(t.path(name), 0755); err != nil {
+		t.t.Fatal(err)
+	}
+}
+
+// Set changes an attribute as the hardware would, without recording a write
+func (t *Tree) Set(name string, value string) {
+	t.mkdir(filepath.Dir(name))
+	if err := os.WriteFile(t.path(name), []byte(value), 0644); err != nil {
+		t.t.Fatal(err)
+	}
+}
+
+// Read returns the content of an attribute without the trailing new line, or "" if it does not exist
+func (t *Tree) Read(name string) string {
+	data, _ := os.ReadFile(t.path(name))
+	return strings.TrimSpace(string(data))
+}
+
+func (t *Tree) Exists(name string) bool {
+	_, err := os.Stat(t.path(name))
+	return err == nil
+}
+
+// AddGPIOChip adds a gpiochip with named lines, visible both to the resolver
+// and to the legacy /sys/class/gpio interface starting at base
+func (t *Tree) AddGPIOChip(chip string, label string, base int, names ...string) {
+	device := filepath.Join("/sys/devices/platform/bus@100000", label, chip)
+	t.Set(filepath.Join(device, "of_node", "gpio-line-names"), strings.Join(names, "\x00")+"\x00")
+	t.mkdir("/sys/bus/gpio/devices")
+	if err := os.Symlink(t.path(device), t.path(filepath.Join("/sys/bus/gpio/devices", chip))); err != nil {
+		t.t.Fatal(err)
+	}
+	legacy := fmt.Sprintf("/sys/class/gpio/gpiochip%d", base)
+	t.Set(filepath.Join(legacy, "label"), label+"\n")
+	t.Set(filepath.Join(legacy, "base"), fmt.Sprintf("%d\n", base))
+	t.Set(filepath.Join(legacy, "ngpio"), fmt.Sprintf("%d\n", len(names)))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for offset := range names {
+		t.lines[base+offset] = true
+	}
+}
+
+// AddBonePWM adds a /dev/bone/pwm/<bus>/<channel> channel, disabled and with zero period
+func (t *Tree) AddBonePWM(bus int, channel string) {
+	dir := fmt.Sprintf("/dev/bone/pwm/%d/%s", bus, channel)
+	t.Set(filepath.Join(dir, "period"), "0\n")
+	t.Set(filepath.Join(dir, "duty_cycle"), "0\n")
+	t.Set(filepath.Join(dir, "polarity"), "normal\n")
+	t.Set(filepath.Join(dir, "enable"), "0\n")
+}
+
+// AddPWMChip adds a /sys/class/pwm/pwmchip<chip> with npwm channels to export,
+// its device is the platform device of the device tree node, e.g. "3000000.pwm"
+func (t *Tree) AddPWMChip(chip int, node string, npwm int) {
+	device := filepath.Join("/sys/devices/platform/bus@100000", node)
+	dir := fmt.Sprintf("/sys/class/pwm/pwmchip%d", chip)
+	t.Set(filepath.Join(dir, "npwm"), fmt.Sprintf("%d\n", npwm))
+	t.Set(filepath.Join(dir, "export"), "")
+	t.Set(filepath.Join(dir, "unexport"), "")
+	t.mkdir(device)
+	if err := os.Symlink(t.path(device), t.path(filepath.Join(dir, "device"))); err != nil {
+		t.t.Fatal(err)
+	}
+}
+
+// Writes returns all the writes made so far, including the rejected ones
+func (t *Tree) Writes() []Write {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Write(nil), t.writes...)
+}
+
+// WritesTo returns the data successfully written to one attribute, in order
+func (t *Tree) WritesTo(name string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data := []string{}
+	for _, write := range t.writes {
+		if write.Path == name && write.Err == nil {
+			data = append(data, write.Data)
+		}
+	}
+	return data
+}
+
+func (t *Tree) ResetWrites() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.writes = nil
+}
+
+func (t *Tree) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(t.path(name))
+}
+
+func (t *Tree) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(t.path(name))
+}
+
+func (t *Tree) WriteFile(name string, data []byte) error {
+	return t.write(name, string(data))
+}
+
+func (t *Tree) OpenFile(name string, flag int) (sysfs.File, error) {
+	f, err := os.OpenFile(t.path(name), flag&^(os.O_CREATE|os.O_TRUNC), 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &file{File: f, tree: t, name: name}, nil
+}
+
+// file reads straight from the tree but applies the semantics to every write
+type file struct {
+	*os.File
+	tree *Tree
+	name string
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	if err := f.tree.write(f.name, string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *Tree) write(name string, data string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.apply(name, strings.TrimSpace(data))
+	if err != nil {
+		err = &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+	t.writes = append(t.writes, Write{Path: name, Data: data, Err: err})
+	return err
+}
+
+func (t *Tree) store(name string, value string) error {
+	return os.WriteFile(t.path(name), []byte(value+"\n"), 0644)
+}
+
+func (t *Tree) apply(name string, value string) error {
+	if !t.Exists(name) {
+		return syscall.ENOENT
+	}
+	dir, attr := filepath.Split(name)
+	dir = filepath.Clean(dir)
+	switch {
+	case name == "/sys/class/gpio/export":
+		return t.export(value)
+	case name == "/sys/class/gpio/unexport":
+		return t.unexport(value)
+	case filepath.Dir(dir) == "/sys/class/gpio" && strings.HasPrefix(filepath.Base(dir), "gpio"):
+		return t.applyGPIO(dir, attr, value)
+	case filepath.Dir(dir) == "/sys/class/pwm" && (attr == "export" || attr == "unexport"):
+		return t.exportPWM(dir, attr, value)
+	case attr == "period" || attr == "duty_cycle" || attr == "polarity" || attr == "enable":
+		return t.applyPWM(dir, attr, value)
+	}
+	return t.store(name, value)
+}
+
+func (t *Tree) export(value string) error {
+	number, err := strconv.Atoi(value)
+	if err != nil || !t.lines[number] {
+		return syscall.EINVAL
+	}
+	dir := fmt.Sprintf("/sys/class/gpio/gpio%d", number)
+	if t.Exists(dir) {
+		return syscall.EBUSY
+	}
+	t.Set(filepath.Join(dir, "value"), "0\n")
+	t.Set(filepath.Join(dir, "direction"), "in\n")
+	t.Set(filepath.Join(dir, "edge"), "none\n")
+	t.Set(filepath.Join(dir, "active_low"), "0\n")
+	return nil
+}
+
+func (t *Tree) unexport(value string) error {
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return syscall.EINVAL
+	}
+	dir := fmt.Sprintf("/sys/class/gpio/gpio%d", number)
+	if !t.Exists(dir) {
+		return syscall.EINVAL
+	}
+	return os.RemoveAll(t.path(dir))
+}
+
+func (t *Tree) applyGPIO(dir string, attr string, value string) error {
+	name := filepath.Join(dir, attr)
+	switch attr {
+	case "value":
+		if t.Read(filepath.Join(dir, "direction")) != "out" {
+			return syscall.EPERM
+		}
+		if value != "0" && value != "1" {
+			return syscall.EINVAL
+		}
+		return t.store(name, value)
+	case "direction":
+		switch value {
+		case "in", "out":
+			return t.store(name, value)
+		case "high", "low":
+			level := "0"
+			if value == "high" {
+				level = "1"
+			}
+			t.store(filepath.Join(dir, "value"), level)
+			return t.store(name, "out")
+		}
+		return syscall.EINVAL
+	case "edge":
+		switch value {
+		case "none", "rising", "falling", "both":
+			return t.store(name, value)
+		}
+		return syscall.EINVAL
+	}
+	return t.store(name, value)
+}
+
+func (t *Tree) exportPWM(chipDir string, attr string, value string) error {
+	index, err := strconv.Atoi(value)
+	npwm, _ := strconv.Atoi(t.Read(filepath.Join(chipDir, "npwm")))
+	if err != nil || index < 0 || index >= npwm {
+		return syscall.EINVAL
+	}
+	dir := fmt.Sprintf("%s/pwm%d", chipDir, index)
+	if attr == "unexport" {
+		if !t.Exists(dir) {
+			return syscall.EINVAL
+		}
+		return os.RemoveAll(t.path(dir))
+	}
+	if t.Exists(dir) {
+		return syscall.EBUSY
+	}
+	t.Set(filepath.Join(dir, "period"), "0\n")
+	t.Set(filepath.Join(dir, "duty_cycle"), "0\n")
+	t.Set(filepath.Join(dir, "polarity"), "normal\n")
+	t.Set(filepath.Join(dir, "enable"), "0\n")
+	return nil
+}
+
+func (t *Tree) applyPWM(dir string, attr string, value string) error {
+	name := filepath.Join(dir, attr)
+	read := func(attr string) int64 {
+		value, _ := strconv.ParseInt(t.Read(filepath.Join(dir, attr)), 10, 64)
+		return value
+	}
+	switch attr {
+	case "period", "duty_cycle":
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || number < 0 {
+			return syscall.EINVAL
+		}
+		if attr == "period" && number < read("duty_cycle") {
+			return syscall.EINVAL
+		}
+		if attr == "duty_cycle" && number > read("period") {
+			return syscall.EINVAL
+		}
+	case "polarity":
+		if value != "normal" && value != "inversed" {
+			return syscall.EINVAL
+		}
+		if read("enable") == 1 {
+			return syscall.EBUSY
+		}
+	case "enable":
+		if value != "0" && value != "1" {
+			return syscall.EINVAL
+		}
+	}
+	return t.store(name, value)
+}
@@ -0,0 +1,240 @@
+package hwtest
+
+import (
+	"bbai64/i2c"
+	"encoding/binary"
+	"sync"
+	"syscall"
+)
+
+// errors of the kernel i2c drivers
+var (
+	ErrAddressNACK = syscall.ENXIO     // no device acknowledged the address
+	ErrNACK        = i2c.ErrNACK       // the device did not acknowledge a byte
+	ErrTimeout     = syscall.ETIMEDOUT // the bus stayed busy, e.g. a device holds the clock low
+)
+
+// I2CDevice is a simulated device, it sees each message of a transfer addressed to it
+type I2CDevice interface {
+	Write(data []byte) error
+	Read(buf []byte) error
+}
+
+// I2CTransfer is a transfer made through the bus, Err is what the simulated kernel answered
+type I2CTransfer struct {
+	Msgs []i2c.Msg
+	Err  error
+}
+
+type i2cFault struct {
+	err   error
+	count int
+}
+
+// I2CBus is a simulated i2c bus, it implements i2c.Conn.
+// Addresses without a device answer ErrAddressNACK.
+type I2CBus struct {
+	mu        sync.Mutex
+	devices   map[uint8]I2CDevice
+	faults    map[uint8]*i2cFault
+	transfers []I2CTransfer
+}
+
+func NewI2CBus() *I2CBus {
+	return &I2CBus{
+		devices: map[uint8]I2CDevice{},
+		faults:  map[uint8]*i2cFault{},
+	}
+}
+
+func (b *I2CBus) Attach(address uint8, device I2CDevice) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.devices[address] = device
+}
+
+func (b *I2CBus) Detach(address uint8) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.devices, address)
+}
+
+// Fail makes the next count transfers to the address fail with err, e.g. ErrNACK or ErrTimeout.
+// A negative count makes all of them fail until Fail is called again with a count of 0.
+func (b *I2CBus) Fail(address uint8, err error, count int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if count == 0 {
+		delete(b.faults, address)
+		return
+	}
+	b.faults[address] = &i2cFault{err: err, count: count}
+}
+
+func (b *I2CBus) Transfer(msgs ...i2c.Msg) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.transfer(msgs)
+	transfer := I2CTransfer{Err: err}
+	for _, msg := range msgs {
+		msg.Buf = append([]byte(nil), msg.Buf...)
+		transfer.Msgs = append(transfer.Msgs, msg)
+	}
+	b.transfers = append(b.transfers, transfer)
+	return err
+}
+
+func (b *I2CBus) transfer(msgs []i2c.Msg) error {
+	for _, msg := range msgs {
+		if fault := b.faults[msg.Address]; fault != nil {
+			if fault.count > 0 {
+				fault.count--
+				if fault.count == 0 {
+					delete(b.faults, msg.Address)
+				}
+			}
+			return fault.err
+		}
+	}
+	for _, msg := range msgs {
+		device := b.devices[msg.Address]
+		if device == nil {
+			return ErrAddressNACK
+		}
+		var err error
+		if msg.Read {
+			err = device.Read(msg.Buf)
+		} else {
+			err = device.Write(msg.Buf)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Transfers returns the transfers made so far, with copies of the messages as they were sent and answered
+func (b *I2CBus) Transfers() []I2CTransfer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]I2CTransfer(nil), b.transfers...)
+}
+
+func (b *I2CBus) ResetTransfers() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.transfers = nil
+}
+
+// I2CRegisters is a simulated device with a register map: the first byte written selects
+// the register, the following bytes are written to it and reads start at it.
+// The register moves to the next one every width bytes.
+type I2CRegisters struct {
+	mu      sync.Mutex
+	width   int
+	order   binary.ByteOrder
+	values  map[uint8]uint64
+	reg     uint8
+	onRead  map[uint8]func() uint64
+	onWrite map[uint8]func(value uint64) error
+}
+
+// NewI2CRegisters returns a register map with registers of width bytes in the byte order
+func NewI2CRegisters(width int, order binary.ByteOrder) *I2CRegisters {
+	return &I2CRegisters{
+		width:   width,
+		order:   order,
+		values:  map[uint8]uint64{},
+		onRead:  map[uint8]func() uint64{},
+		onWrite: map[uint8]func(value uint64) error{},
+	}
+}
+
+func (r *I2CRegisters) Set(reg uint8, value uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[reg] = value
+}
+
+func (r *I2CRegisters) Get(reg uint8) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.values[reg]
+}
+
+// OnRead scripts the value of the register, read computes it on every read
+func (r *I2CRegisters) OnRead(reg uint8, read func() uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onRead[reg] = read
+}
+
+// OnWrite is called with every value written to the register, an error is answered as a NACK
+func (r *I2CRegisters) OnWrite(reg uint8, write func(value uint64) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onWrite[reg] = write
+}
+
+func (r *I2CRegisters) Write(data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// a write without data, e.g. from a bus scan, only checks for the ACK
+	if len(data) == 0 {
+		return nil
+	}
+	r.reg = data[0]
+	data = data[1:]
+	for len(data) >= r.width {
+		value := r.decode(data[:r.width])
+		if write := r.onWrite[r.reg]; write != nil {
+			if err := write(value); err != nil {
+				return ErrNACK
+			}
+		}
+		r.values[r.reg] = value
+		r.reg++
+		data = data[r.width:]
+	}
+	if len(data) > 0 {
+		return ErrNACK
+	}
+	return nil
+}
+
+func (r *I2CRegisters) Read(buf []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg := r.reg
+	for i := 0; i < len(buf); i += r.width {
+		value := r.values[reg]
+		if read := r.onRead[reg]; read != nil {
+			value = read()
+		}
+		raw := r.encode(value)
+		copy(buf[i:], raw)
+		reg++
+	}
+	return nil
+}
+
+func (r *I2CRegisters) decode(data []byte) uint64 {
+	buf := make([]byte, 8)
+	if r.order == binary.BigEndian {
+		copy(buf[8-len(data):], data)
+		return binary.BigEndian.Uint64(buf)
+	}
+	copy(buf, data)
+	return binary.LittleEndian.Uint64(buf)
+}
+
+func (r *I2CRegisters) encode(value uint64) []byte {
+	buf := make([]byte, 8)
+	if r.order == binary.BigEndian {
+		binary.BigEndian.PutUint64(buf, value)
+		return buf[8-r.width:]
+	}
+	binary.LittleEndian.PutUint64(buf, value)
+	return buf[:r.width]
+}
@@ -0,0 +1,28 @@
+package hwtest_test
+
+import (
+	"bbai64/hwtest"
+	"encoding/binary"
+	"testing"
+)
+
+func TestI2CRegistersEmptyWrite(t *testing.T) {
+	registers := hwtest.NewI2CRegisters(2, binary.BigEndian)
+	registers.Set(0x06, 0xABCD)
+	if err := registers.Write([]byte{0x05, 0x12, 0x34}); err != nil {
+		t.Fatal(err)
+	}
+	// the write leaves the register pointer on the next register, 0x06.
+	// A write without data, like the probe of a bus scan, is acked and neither
+	// writes a register nor moves the register pointer
+	if err := registers.Write(nil); err != nil {
+		t.Errorf("expected an empty write to be acked, got %v", err)
+	}
+	if value := registers.Get(0x05); value != 0x1234 {
+		t.Errorf("unexpected register 0x%04x", value)
+	}
+	buf := make([]byte, 2)
+	if err := registers.Read(buf); err != nil || buf[0] != 0xAB || buf[1] != 0xCD {
+		t.Errorf("unexpected read % x: %v", buf, err)
+	}
+}
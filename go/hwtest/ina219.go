@@ -0,0 +1,67 @@
+package hwtest
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// INA219 is a simulated current monitor reporting the shunt and bus voltages chosen by the test,
+// the current and power registers are computed like the chip does once it is calibrated.
+// based on: https://www.ti.com/lit/ds/symlink/ina219.pdf
+type INA219 struct {
+	*I2CRegisters
+	mu    sync.Mutex
+	shunt float64
+	bus   float64
+}
+
+const (
+	ina219Config       = 0x00
+	ina219ShuntVoltage = 0x01
+	ina219BusVoltage   = 0x02
+	ina219Power        = 0x03
+	ina219Current      = 0x04
+	ina219Calibration  = 0x05
+)
+
+func NewINA219() *INA219 {
+	m := &INA219{I2CRegisters: NewI2CRegisters(2, binary.BigEndian)}
+	m.Set(ina219Config, 0x399F) // power-on reset value
+	m.OnRead(ina219ShuntVoltage, func() uint64 { return uint64(uint16(m.shuntRegister())) })
+	m.OnRead(ina219BusVoltage, func() uint64 { return uint64(m.busRegister()<<3 | 0x2) }) // conversion ready
+	m.OnRead(ina219Current, func() uint64 { return uint64(uint16(m.currentRegister())) })
+	m.OnRead(ina219Power, func() uint64 {
+		return uint64(uint16(int64(math.Abs(float64(m.currentRegister()))) * int64(m.busRegister()) / 5000))
+	})
+	return m
+}
+
+// SetVoltages sets the voltage across the shunt, negative when the current flows backward, and on the bus
+func (m *INA219) SetVoltages(shunt float64, bus float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shunt = shunt
+	m.bus = bus
+}
+
+// shuntRegister has a 10µV LSB
+func (m *INA219) shuntRegister() int16 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int16(math.Round(m.shunt / 10e-6))
+}
+
+// busRegister has a 4mV LSB, the register holds it shifted by 3
+func (m *INA219) busRegister() uint16 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return uint16(math.Round(m.bus / 4e-3))
+}
+
+// currentRegister is zero until the calibration register is written
+func (m *INA219) currentRegister() int16 {
+	// the callbacks run with the register lock held, read the calibration directly
+	calibration := int64(m.values[ina219Calibration])
+	return int16(int64(m.shuntRegister()) * calibration / 4096)
+}
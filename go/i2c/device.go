@@ -0,0 +1,62 @@
+package i2c
+
+import "fmt"
+
+// Conn runs combined transfers, it is implemented by Bus and can be simulated in tests
+type Conn interface {
+	Transfer(msgs ...Msg) error
+}
+
+// Device is a device at one address, drivers take it instead of a bus and an address
+type Device interface {
+	Address() uint8
+	// Tx writes w then reads into r with a repeated start in between, either of them may be empty
+	Tx(w []byte, r []byte) error
+	// ReadRegs reads len(buf) bytes starting at the register
+	ReadRegs(reg uint8, buf []byte) error
+	// WriteRegs writes the data starting at the register
+	WriteRegs(reg uint8, data []byte) error
+}
+
+type device struct {
+	conn    Conn
+	address uint8
+}
+
+// NewDevice returns the device at the address of the connection
+func NewDevice(conn Conn, address uint8) Device {
+	return &device{
+		conn:    conn,
+		address: address,
+	}
+}
+
+func (d *device) Address() uint8 {
+	return d.address
+}
+
+func (d *device) Tx(w []byte, r []byte) error {
+	return tx(d.conn, d.address, w, r)
+}
+
+func (d *device) ReadRegs(reg uint8, buf []byte) error {
+	return d.Tx([]byte{reg}, buf)
+}
+
+func (d *device) WriteRegs(reg uint8, data []byte) error {
+	return d.Tx(append([]byte{reg}, data...), nil)
+}
+
+func tx(conn Conn, address uint8, w []byte, r []byte) error {
+	msgs := make([]Msg, 0, 2)
+	if len(w) > 0 {
+		msgs = append(msgs, Msg{Address: address, Buf: w})
+	}
+	if len(r) > 0 {
+		msgs = append(msgs, Msg{Address: address, Read: true, Buf: r})
+	}
+	if err := conn.Transfer(msgs...); err != nil {
+		return fmt.Errorf("unable to transfer with i2c device 0x%02x: %w", address, err)
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package i2c
 
 import (
+	"encoding/binary"
 	"os"
+	"sync"
 )
 
 type BusNumber int
@@ -14,7 +16,136 @@ const (
 )
 
 type Bus struct {
-	f *os.File
+	mu     sync.Mutex // serializes the SMBus calls which configure the file before the transfer, guards tracer
+	f      *os.File
+	tracer *Tracer
 }
 
 const DevicePath = "/dev/bone/i2c/%d"
+
+// MESSAGE_LENGTH_MAX is the longest message the kernel accepts in one transfer
+const MESSAGE_LENGTH_MAX = 0xFFFF
+
+// Msg is one message of a combined transfer, messages after the first start with a repeated start
+type Msg struct {
+	Address uint8
+	Read    bool
+	Buf     []byte
+}
+
+// Transfer sends the messages as one combined transfer with repeated starts in between
+func (b *Bus) Transfer(msgs ...Msg) error {
+	b.mu.Lock()
+	tracer := b.tracer
+	b.mu.Unlock()
+	err := b.rdwr(msgs)
+	if tracer != nil {
+		tracer.Record(msgs, err)
+	}
+	return err
+}
+
+// SetTracer records the transfers, nil stops recording. Close closes the tracer.
+// The SMBus commands going through the I2C_SMBUS ioctl are not recorded.
+func (b *Bus) SetTracer(tracer *Tracer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tracer = tracer
+}
+
+// closeTracer stops recording and returns the error of the trace, if any
+func (b *Bus) closeTracer() error {
+	b.mu.Lock()
+	tracer := b.tracer
+	b.tracer = nil
+	b.mu.Unlock()
+	if tracer == nil {
+		return nil
+	}
+	return tracer.Close()
+}
+
+// Tx writes w then reads into r with a repeated start in between, so no other master
+// can take the bus. Either of them may be empty.
+func (b *Bus) Tx(address uint8, w []byte, r []byte) error {
+	return tx(b, address, w, r)
+}
+
+// Device returns the device at the address of the bus
+func (b *Bus) Device(address uint8) Device {
+	return NewDevice(b, address)
+}
+
+// ReadRegs reads len(buf) bytes starting at the register, most devices increment the register on their own
+func (b *Bus) ReadRegs(address uint8, reg uint8, buf []byte) error {
+	return b.Tx(address, []byte{reg}, buf)
+}
+
+// WriteRegs writes the data starting at the register
+func (b *Bus) WriteRegs(address uint8, reg uint8, data []byte) error {
+	return b.Tx(address, append([]byte{reg}, data...), nil)
+}
+
+// ReadRegs16 is ReadRegs for devices with 16-bit register addresses, e.g. EEPROMs, sent most significant byte first
+func (b *Bus) ReadRegs16(address uint8, reg uint16, buf []byte) error {
+	return b.Tx(address, binary.BigEndian.AppendUint16(nil, reg), buf)
+}
+
+// WriteRegs16 is WriteRegs for devices with 16-bit register addresses
+func (b *Bus) WriteRegs16(address uint8, reg uint16, data []byte) error {
+	return b.Tx(address, append(binary.BigEndian.AppendUint16(nil, reg), data...), nil)
+}
+
+// ReadUint16 reads a 16-bit register value in the byte order of the device
+func (b *Bus) ReadUint16(address uint8, reg uint8, order binary.ByteOrder) (uint16, error) {
+	buf := make([]byte, 2)
+	if err := b.ReadRegs(address, reg, buf); err != nil {
+		return 0, err
+	}
+	return order.Uint16(buf), nil
+}
+
+// WriteUint16 writes a 16-bit register value in the byte order of the device
+func (b *Bus) WriteUint16(address uint8, reg uint8, order binary.ByteOrder, data uint16) error {
+	buf := make([]byte, 2)
+	order.PutUint16(buf, data)
+	return b.WriteRegs(address, reg, buf)
+}
+
+// ReadUint32 reads a 32-bit register value in the byte order of the device
+func (b *Bus) ReadUint32(address uint8, reg uint8, order binary.ByteOrder) (uint32, error) {
+	buf := make([]byte, 4)
+	if err := b.ReadRegs(address, reg, buf); err != nil {
+		return 0, err
+	}
+	return order.Uint32(buf), nil
+}
+
+// WriteUint32 writes a 32-bit register value in the byte order of the device
+func (b *Bus) WriteUint32(address uint8, reg uint8, order binary.ByteOrder, data uint32) error {
+	buf := make([]byte, 4)
+	order.PutUint32(buf, data)
+	return b.WriteRegs(address, reg, buf)
+}
+
+func (b *Bus) ReadByte(address uint8, offset uint8) (uint8, error) {
+	buf := []uint8{0}
+	if err := b.ReadRegs(address, offset, buf); err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+// ReadWord reads a big-endian word, see ReadUint16 for other byte orders
+func (b *Bus) ReadWord(address uint8, offset uint8) (uint16, error) {
+	return b.ReadUint16(address, offset, binary.BigEndian)
+}
+
+func (b *Bus) WriteByte(address uint8, offset uint8, data uint8) error {
+	return b.WriteRegs(address, offset, []byte{data})
+}
+
+// WriteWord writes a big-endian word, see WriteUint16 for other byte orders
+func (b *Bus) WriteWord(address uint8, offset uint8, data uint16) error {
+	return b.WriteUint16(address, offset, binary.BigEndian, data)
+}
@@ -6,8 +6,10 @@ package i2c
 // original: https://gist.github.com/tetsu-koba/33b339d26ac9c730fb09773acf39eac5#file-i2c-go
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"runtime"
 	"syscall"
 	"unsafe"
 )
@@ -18,6 +20,12 @@ const (
 	I2C_M_RD                = 0x0001
 )
 
+// ErrNACK is what the kernel answers when the device does not acknowledge a byte
+var ErrNACK error = syscall.EREMOTEIO
+
+// transientErrors are worth retrying, see Transient
+var transientErrors = []error{ErrNACK, syscall.EAGAIN}
+
 type i2cMessage struct {
 	addr      uint16
 	flags     uint16
@@ -37,84 +45,44 @@ func Open(busNumber BusNumber) (*Bus, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Bus{f: f}, nil
+	bus := &Bus{f: f}
+	if err := bus.traceFromEnv(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return bus, nil
 }
 
+// Close closes the bus and its tracer, see SetTracer
 func (b *Bus) Close() (err error) {
-	return b.f.Close()
+	return errors.Join(b.closeTracer(), b.f.Close())
 }
 
-func (b *Bus) ReadByte(address uint8, offset uint8) (uint8, error) {
-	buf := []uint8{0}
-	msg := []i2cMessage{
-		{
-			addr:  uint16(address),
-			flags: 0,
-			len:   1,
-			buf:   uintptr(unsafe.Pointer(&offset)),
-		},
-		{
-			addr:  uint16(address),
-			flags: uint16(I2C_M_RD),
-			len:   uint16(len(buf)),
-			buf:   uintptr(unsafe.Pointer(&buf[0])),
-		},
+// rdwr sends the messages as one combined transfer with repeated starts in between
+func (b *Bus) rdwr(msgs []Msg) error {
+	if len(msgs) == 0 {
+		return nil
 	}
-	err := transfer(b.f, &msg[0], len(msg))
-	if err != nil {
-		return 0, err
-	}
-	return buf[0], nil
-}
-
-func (b *Bus) ReadWord(address uint8, offset uint8) (uint16, error) {
-	buf := []uint8{0, 0}
-	msg := []i2cMessage{
-		{
-			addr:  uint16(address),
-			flags: 0,
-			len:   1,
-			buf:   uintptr(unsafe.Pointer(&offset)),
-		},
-		{
-			addr:  uint16(address),
-			flags: uint16(I2C_M_RD),
-			len:   uint16(len(buf)),
-			buf:   uintptr(unsafe.Pointer(&buf[0])),
-		},
+	if len(msgs) > I2C_RDRW_IOCTL_MAX_MSGS {
+		return fmt.Errorf("%d messages exceed the limit of %d", len(msgs), I2C_RDRW_IOCTL_MAX_MSGS)
 	}
-	err := transfer(b.f, &msg[0], len(msg))
-	if err != nil {
-		return 0, err
-	}
-	word := (uint16(buf[0]) << 8) | uint16(buf[1])
-	return word, err
-}
-
-func (b *Bus) WriteByte(address uint8, offset uint8, data uint8) error {
-	buf := []uint8{offset, data}
-	msg := []i2cMessage{
-		{
-			addr:  uint16(address),
-			flags: 0,
-			len:   uint16(len(buf)),
-			buf:   uintptr(unsafe.Pointer(&buf[0])),
-		},
-	}
-	return transfer(b.f, &msg[0], len(msg))
-}
-
-func (b *Bus) WriteWord(address uint8, offset uint8, data uint16) error {
-	buf := []uint8{offset, uint8((data >> 8)), uint8(data)}
-	msg := []i2cMessage{
-		{
-			addr:  uint16(address),
-			flags: 0,
-			len:   uint16(len(buf)),
-			buf:   uintptr(unsafe.Pointer(&buf[0])),
-		},
+	raw := make([]i2cMessage, len(msgs))
+	for i, msg := range msgs {
+		if len(msg.Buf) == 0 || len(msg.Buf) > MESSAGE_LENGTH_MAX {
+			return fmt.Errorf("invalid message length %d", len(msg.Buf))
+		}
+		raw[i] = i2cMessage{
+			addr: uint16(msg.Address),
+			len:  uint16(len(msg.Buf)),
+			buf:  uintptr(unsafe.Pointer(&msg.Buf[0])),
+		}
+		if msg.Read {
+			raw[i].flags = uint16(I2C_M_RD)
+		}
 	}
-	return transfer(b.f, &msg[0], len(msg))
+	err := transfer(b.f, &raw[0], len(raw))
+	runtime.KeepAlive(msgs)
+	return err
 }
 
 func transfer(f *os.File, msgs *i2cMessage, n int) (err error) {
@@ -5,8 +5,15 @@ package i2c
 
 import (
 	"errors"
+	"syscall"
 )
 
+// ErrNACK stands for a byte the device did not acknowledge, there is no EREMOTEIO on this platform
+var ErrNACK error = syscall.EIO
+
+// transientErrors are worth retrying, see Transient
+var transientErrors = []error{ErrNACK, syscall.EAGAIN}
+
 var noImplementationError = errors.New("There is no implementation of i2c bus for this platform!")
 
 func Open(busNumber BusNumber) (c *Bus, err error) {
@@ -14,21 +21,17 @@ func Open(busNumber BusNumber) (c *Bus, err error) {
 }
 
 func (b *Bus) Close() (err error) {
-	return b.f.Close()
+	return errors.Join(b.closeTracer(), b.f.Close())
 }
 
-func (b *Bus) ReadByte(address uint8, offset uint8) (uint8, error) {
-	return 0, noImplementationError
+func (b *Bus) rdwr(msgs []Msg) error {
+	return noImplementationError
 }
 
-func (b *Bus) ReadWord(address uint8, offset uint8) (uint16, error) {
+func (b *Bus) Functionality() (Functionality, error) {
 	return 0, noImplementationError
 }
 
-func (b *Bus) WriteByte(address uint8, offset uint8, data uint8) error {
-	return noImplementationError
-}
-
-func (b *Bus) WriteWord(address uint8, offset uint8, data uint16) error {
+func (b *Bus) smbusXfer(address uint8, pec bool, readWrite uint8, command uint8, size uint32, data *smbusData) error {
 	return noImplementationError
 }
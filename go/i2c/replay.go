@@ -0,0 +1,142 @@
+package i2c
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var ErrReplayMismatch = errors.New("transfer does not match the recording")
+var ErrReplayEnd = errors.New("end of the recording")
+var ErrReplayed = errors.New("recorded error")
+
+type traceRecord struct {
+	line   int
+	msgs   []Msg
+	result int64
+}
+
+// Replay serves a recorded trace, see Tracer, it implements Conn. Every transfer has to match
+// the next recorded one: same addresses, directions, written bytes and read lengths.
+// It gets the recorded bytes and result, whatever the time it comes at.
+type Replay struct {
+	mu      sync.Mutex
+	records []traceRecord
+	next    int
+}
+
+// LoadReplay parses a trace, only the transfers with the given addresses are kept if any
+func LoadReplay(r io.Reader, addresses ...uint8) (*Replay, error) {
+	keep := map[uint8]bool{}
+	for _, address := range addresses {
+		keep[address] = true
+	}
+	replay := &Replay{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		record, err := parseTraceRecord(text)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse i2c trace line %d: %w", line, err)
+		}
+		record.line = line
+		if len(keep) == 0 || keep[record.msgs[0].Address] {
+			replay.records = append(replay.records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read i2c trace: %w", err)
+	}
+	return replay, nil
+}
+
+// OpenReplay loads the trace file, see LoadReplay
+func OpenReplay(path string, addresses ...uint8) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open i2c trace: %w", err)
+	}
+	defer f.Close()
+	return LoadReplay(f, addresses...)
+}
+
+func parseTraceRecord(text string) (traceRecord, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 3 {
+		return traceRecord{}, fmt.Errorf("expected a timestamp, messages and a result in %q", text)
+	}
+	if _, err := strconv.ParseInt(fields[0], 10, 64); err != nil {
+		return traceRecord{}, fmt.Errorf("invalid timestamp %q", fields[0])
+	}
+	result, err := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+	if err != nil {
+		return traceRecord{}, fmt.Errorf("invalid result %q", fields[len(fields)-1])
+	}
+	record := traceRecord{result: result}
+	for _, field := range fields[1 : len(fields)-1] {
+		address, data, ok := strings.Cut(field[min(len(field), 1):], ":")
+		if !ok || (field[0] != 'w' && field[0] != 'r') {
+			return traceRecord{}, fmt.Errorf("invalid message %q", field)
+		}
+		a, err := hex.DecodeString(address)
+		if err != nil || len(a) != 1 {
+			return traceRecord{}, fmt.Errorf("invalid address in message %q", field)
+		}
+		buf, err := hex.DecodeString(data)
+		if err != nil {
+			return traceRecord{}, fmt.Errorf("invalid data in message %q", field)
+		}
+		record.msgs = append(record.msgs, Msg{Address: a[0], Read: field[0] == 'r', Buf: buf})
+	}
+	return record, nil
+}
+
+func (r *Replay) Transfer(msgs ...Msg) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next >= len(r.records) {
+		return ErrReplayEnd
+	}
+	record := r.records[r.next]
+	if len(msgs) != len(record.msgs) {
+		return fmt.Errorf("%w at line %d: %d messages instead of %d", ErrReplayMismatch, record.line, len(msgs), len(record.msgs))
+	}
+	for i, msg := range msgs {
+		recorded := record.msgs[i]
+		if msg.Address != recorded.Address || msg.Read != recorded.Read || len(msg.Buf) != len(recorded.Buf) ||
+			(!msg.Read && !bytes.Equal(msg.Buf, recorded.Buf)) {
+			return fmt.Errorf("%w at line %d: message %d", ErrReplayMismatch, record.line, i)
+		}
+	}
+	r.next++
+	for i, msg := range msgs {
+		if msg.Read {
+			copy(msg.Buf, record.msgs[i].Buf)
+		}
+	}
+	switch {
+	case record.result > 0:
+		return syscall.Errno(record.result)
+	case record.result < 0:
+		return ErrReplayed
+	}
+	return nil
+}
+
+// Remaining returns the number of recorded transfers not replayed yet
+func (r *Replay) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.records) - r.next
+}
@@ -0,0 +1,91 @@
+package i2c
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// valid 7-bit addresses, 0x00-0x07 and 0x78-0x7F are reserved by the specification
+const (
+	ADDRESS_MIN uint8 = 0x08
+	ADDRESS_MAX uint8 = 0x77
+)
+
+type Presence string
+
+const (
+	ABSENT  Presence = "absent"
+	PRESENT Presence = "present"
+	CLAIMED Presence = "claimed" // a kernel driver uses the address, it is not probed
+)
+
+type Found struct {
+	Address  uint8    `json:"address"`
+	Presence Presence `json:"presence"`
+}
+
+var ErrNoProbe = errors.New("adapter supports neither quick commands nor byte reads")
+
+// Probe tells if a device answers at the address, see Scan
+func (b *Bus) Probe(address uint8) (Presence, error) {
+	funcs, err := b.Functionality()
+	if err != nil {
+		return ABSENT, fmt.Errorf("unable to probe i2c device 0x%02x: %w", address, err)
+	}
+	return probe(address, funcs, b.probeDevice)
+}
+
+// Scan probes every valid 7-bit address the way i2cdetect does: a quick write,
+// or a byte read for the ranges of EEPROMs which a quick write could corrupt.
+// It returns the addresses which are not absent.
+func (b *Bus) Scan() ([]Found, error) {
+	funcs, err := b.Functionality()
+	if err != nil {
+		return nil, fmt.Errorf("unable to scan i2c bus: %w", err)
+	}
+	return scan(funcs, b.probeDevice)
+}
+
+// prober sends a byte read, or a quick write, to the address
+type prober func(address uint8, read bool) error
+
+func (b *Bus) probeDevice(address uint8, read bool) error {
+	smbus := NewSMBus(b, address)
+	if read {
+		_, err := smbus.ReceiveByte()
+		return err
+	}
+	return smbus.Quick(false)
+}
+
+func scan(funcs Functionality, probeDevice prober) ([]Found, error) {
+	found := []Found{}
+	for address := ADDRESS_MIN; address <= ADDRESS_MAX; address++ {
+		presence, err := probe(address, funcs, probeDevice)
+		if err != nil {
+			return found, fmt.Errorf("unable to scan i2c bus: %w", err)
+		}
+		if presence != ABSENT {
+			found = append(found, Found{Address: address, Presence: presence})
+		}
+	}
+	return found, nil
+}
+
+func probe(address uint8, funcs Functionality, probeDevice prober) (Presence, error) {
+	quick := funcs.Has(FUNC_SMBUS_QUICK)
+	read := funcs.Has(FUNC_SMBUS_READ_BYTE)
+	if !quick && !read {
+		return ABSENT, ErrNoProbe
+	}
+	eeprom := (address >= 0x30 && address <= 0x37) || (address >= 0x50 && address <= 0x5F)
+	err := probeDevice(address, read && (eeprom || !quick))
+	switch {
+	case err == nil:
+		return PRESENT, nil
+	case errors.Is(err, syscall.EBUSY):
+		return CLAIMED, nil
+	}
+	return ABSENT, nil
+}
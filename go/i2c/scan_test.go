@@ -0,0 +1,65 @@
+package i2c
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	reads := map[uint8]bool{}
+	found, err := scan(FUNC_SMBUS_QUICK|FUNC_SMBUS_READ_BYTE, func(address uint8, read bool) error {
+		reads[address] = read
+		switch address {
+		case 0x1D, 0x50:
+			return nil
+		case 0x36:
+			// the errors are wrapped by the smbus calls
+			return fmt.Errorf("unable to receive byte: %w", syscall.EBUSY)
+		}
+		return syscall.ENXIO
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Found{{0x1D, PRESENT}, {0x36, CLAIMED}, {0x50, PRESENT}}
+	if len(found) != len(expected) {
+		t.Fatalf("unexpected devices %+v", found)
+	}
+	for i := range expected {
+		if found[i] != expected[i] {
+			t.Errorf("unexpected devices %+v", found)
+		}
+	}
+
+	// byte reads only in the ranges of eeproms, quick writes elsewhere
+	if len(reads) != int(ADDRESS_MAX-ADDRESS_MIN)+1 {
+		t.Errorf("probed %d addresses", len(reads))
+	}
+	for address, read := range reads {
+		eeprom := (address >= 0x30 && address <= 0x37) || (address >= 0x50 && address <= 0x5F)
+		if read != eeprom {
+			t.Errorf("address 0x%02x probed with read %v", address, read)
+		}
+	}
+}
+
+func TestProbeFunctionality(t *testing.T) {
+	var read bool
+	probeDevice := func(address uint8, r bool) error {
+		read = r
+		return nil
+	}
+	// without quick commands every address is probed with a byte read
+	if presence, err := probe(0x20, FUNC_SMBUS_READ_BYTE, probeDevice); err != nil || presence != PRESENT || !read {
+		t.Errorf("unexpected probe %s, read %v: %v", presence, read, err)
+	}
+	// without byte reads the eeproms are probed with a quick write too
+	if presence, err := probe(0x50, FUNC_SMBUS_QUICK, probeDevice); err != nil || presence != PRESENT || read {
+		t.Errorf("unexpected probe %s, read %v: %v", presence, read, err)
+	}
+	if _, err := probe(0x20, FUNC_I2C, probeDevice); !errors.Is(err, ErrNoProbe) {
+		t.Errorf("expected no probe, got %v", err)
+	}
+}
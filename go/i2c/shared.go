@@ -0,0 +1,205 @@
+package i2c
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+const RETRY_COUNT = 3
+const RETRY_BACKOFF = time.Millisecond // doubled after every retry
+
+// DeviceStatus counts the transfers with a device of a shared bus
+type DeviceStatus struct {
+	Address   uint8  `json:"address"`
+	Transfers uint64 `json:"transfers"`
+	Retries   uint64 `json:"retries"`
+	Errors    uint64 `json:"errors"` // transfers which failed after all the retries
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Shared lets goroutines use the devices of one bus: transfers are serialized,
+// the transient errors are retried with a backoff and the errors are counted per device.
+type Shared struct {
+	mu       sync.Mutex // held for a transfer or a transaction
+	conn     Conn
+	closer   io.Closer
+	retries  int
+	backoff  time.Duration
+	statusMu sync.Mutex
+	status   map[uint8]*DeviceStatus
+	devices  map[uint8]*SharedDevice
+	refs     int
+	number   BusNumber
+}
+
+var sharedMu sync.Mutex
+var sharedBuses = map[BusNumber]*Shared{}
+
+// OpenShared opens the bus once for all its users, each of them has to Close it
+func OpenShared(busNumber BusNumber) (*Shared, error) {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if s := sharedBuses[busNumber]; s != nil {
+		s.refs++
+		return s, nil
+	}
+	bus, err := Open(busNumber)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open i2c bus %d: %w", busNumber, err)
+	}
+	s := NewShared(bus)
+	s.closer = bus
+	s.refs = 1
+	s.number = busNumber
+	sharedBuses[busNumber] = s
+	return s, nil
+}
+
+// NewShared shares the connection, e.g. a simulated bus in tests
+func NewShared(conn Conn) *Shared {
+	return &Shared{
+		conn:    conn,
+		retries: RETRY_COUNT,
+		backoff: RETRY_BACKOFF,
+		status:  map[uint8]*DeviceStatus{},
+		devices: map[uint8]*SharedDevice{},
+	}
+}
+
+// Close closes the bus once its last user closed it
+func (s *Shared) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if s.refs--; s.refs > 0 {
+		return nil
+	}
+	delete(sharedBuses, s.number)
+	return s.closer.Close()
+}
+
+// SetRetries changes how many times and after how long a transient error is retried
+func (s *Shared) SetRetries(retries int, backoff time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retries = retries
+	s.backoff = backoff
+}
+
+// Device returns the handle of the device at the address, the same one for all the callers
+func (s *Shared) Device(address uint8) *SharedDevice {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	if d := s.devices[address]; d != nil {
+		return d
+	}
+	d := &SharedDevice{
+		Device: NewDevice(s, address),
+		shared: s,
+	}
+	s.devices[address] = d
+	return d
+}
+
+// Transfer runs the messages as one transfer while no one else uses the bus
+func (s *Shared) Transfer(msgs ...Msg) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transfer(msgs)
+}
+
+// Status returns the counters of every device the bus talked to, by address
+func (s *Shared) Status() []DeviceStatus {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	status := []DeviceStatus{}
+	for _, st := range s.status {
+		status = append(status, *st)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Address < status[j].Address })
+	return status
+}
+
+// Transient tells if an error is worth retrying: the device did not acknowledge a byte,
+// e.g. while busy with a conversion, or the adapter lost the arbitration
+func Transient(err error) bool {
+	for _, transient := range transientErrors {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+// transfer must be called with the lock held
+func (s *Shared) transfer(msgs []Msg) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	backoff := s.backoff
+	err := s.conn.Transfer(msgs...)
+	retries := 0
+	for ; err != nil && Transient(err) && retries < s.retries; retries++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		err = s.conn.Transfer(msgs...)
+	}
+	s.count(msgs[0].Address, retries, err)
+	return err
+}
+
+func (s *Shared) count(address uint8, retries int, err error) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	status := s.status[address]
+	if status == nil {
+		status = &DeviceStatus{Address: address}
+		s.status[address] = status
+	}
+	status.Transfers++
+	status.Retries += uint64(retries)
+	if err != nil {
+		status.Errors++
+		status.LastError = err.Error()
+	}
+}
+
+// lockedConn transfers on a shared bus whose lock is already held
+type lockedConn struct {
+	shared *Shared
+}
+
+func (c lockedConn) Transfer(msgs ...Msg) error {
+	return c.shared.transfer(msgs)
+}
+
+// SharedDevice is a device of a shared bus, each transfer holds the bus on its own.
+// See Transaction for sequences which must not be interleaved with other transfers.
+type SharedDevice struct {
+	Device
+	shared *Shared
+}
+
+// Transaction holds the bus while f talks to the device, e.g. to start a conversion
+// and read its result without another user reconfiguring the device in between
+func (d *SharedDevice) Transaction(f func(device Device) error) error {
+	d.shared.mu.Lock()
+	defer d.shared.mu.Unlock()
+	return f(NewDevice(lockedConn{d.shared}, d.Address()))
+}
+
+// Status returns the counters of the device
+func (d *SharedDevice) Status() DeviceStatus {
+	d.shared.statusMu.Lock()
+	defer d.shared.statusMu.Unlock()
+	if status := d.shared.status[d.Address()]; status != nil {
+		return *status
+	}
+	return DeviceStatus{Address: d.Address()}
+}
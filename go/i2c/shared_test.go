@@ -0,0 +1,87 @@
+package i2c_test
+
+import (
+	"bbai64/hwtest"
+	"bbai64/i2c"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSharedRetries(t *testing.T) {
+	bus := hwtest.NewI2CBus()
+	bus.Attach(0x41, hwtest.NewI2CRegisters(2, binary.BigEndian))
+	shared := i2c.NewShared(bus)
+	shared.SetRetries(2, time.Microsecond)
+	device := shared.Device(0x41)
+	if shared.Device(0x41) != device {
+		t.Error("expected the same handle for the same address")
+	}
+
+	bus.Fail(0x41, hwtest.ErrNACK, 2)
+	if err := device.WriteRegs(0x05, []byte{0x10, 0x00}); err != nil {
+		t.Errorf("expected the nacks to be retried, got %v", err)
+	}
+	bus.Fail(0x41, hwtest.ErrNACK, 3)
+	if err := device.ReadRegs(0x05, make([]byte, 2)); !errors.Is(err, hwtest.ErrNACK) {
+		t.Errorf("expected a nack after the retries, got %v", err)
+	}
+	bus.Fail(0x41, hwtest.ErrTimeout, 1)
+	if err := device.ReadRegs(0x05, make([]byte, 2)); !errors.Is(err, hwtest.ErrTimeout) {
+		t.Errorf("expected a timeout not to be retried, got %v", err)
+	}
+	buf := make([]byte, 2)
+	if err := device.ReadRegs(0x05, buf); err != nil || buf[0] != 0x10 {
+		t.Errorf("unexpected register % x: %v", buf, err)
+	}
+
+	status := device.Status()
+	if status.Transfers != 4 || status.Retries != 4 || status.Errors != 2 || status.LastError == "" {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if all := shared.Status(); len(all) != 1 || all[0] != status {
+		t.Errorf("unexpected bus status %+v", all)
+	}
+}
+
+func TestSharedTransaction(t *testing.T) {
+	bus := hwtest.NewI2CBus()
+	bus.Attach(0x68, hwtest.NewI2CRegisters(1, binary.BigEndian))
+	shared := i2c.NewShared(bus)
+	device := shared.Device(0x68)
+
+	// each transaction writes a register then reads it back, no other write can come in between
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(value byte) {
+			defer wg.Done()
+			errs <- device.Transaction(func(device i2c.Device) error {
+				if err := device.WriteRegs(0x10, []byte{value}); err != nil {
+					return err
+				}
+				buf := make([]byte, 1)
+				if err := device.ReadRegs(0x10, buf); err != nil {
+					return err
+				}
+				if buf[0] != value {
+					return errors.New("transaction interleaved with another one")
+				}
+				return nil
+			})
+		}(byte(i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if status := device.Status(); status.Transfers != 16 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
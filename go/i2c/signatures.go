@@ -0,0 +1,56 @@
+package i2c
+
+// ChipID is a register holding a fixed value which tells the part apart from others at the same address
+type ChipID struct {
+	Register uint8
+	Value    uint8
+}
+
+type Signature struct {
+	Name        string
+	Description string
+	First       uint8 // address range
+	Last        uint8
+	ID          *ChipID
+}
+
+var Signatures = []Signature{
+	{Name: "INA219", Description: "current and power monitor", First: 0x40, Last: 0x4F},
+	{Name: "PCA9685", Description: "16-channel PWM controller", First: 0x40, Last: 0x77},
+	{Name: "SSD1306", Description: "OLED display controller", First: 0x3C, Last: 0x3D},
+	{Name: "SH1106", Description: "OLED display controller", First: 0x3C, Last: 0x3D},
+	{Name: "MPU-6050", Description: "6-axis IMU", First: 0x68, Last: 0x69, ID: &ChipID{Register: 0x75, Value: 0x68}},
+	{Name: "MPU-9250", Description: "9-axis IMU", First: 0x68, Last: 0x69, ID: &ChipID{Register: 0x75, Value: 0x71}},
+	{Name: "ICM-20948", Description: "9-axis IMU", First: 0x68, Last: 0x69, ID: &ChipID{Register: 0x00, Value: 0xEA}},
+	{Name: "BMI160", Description: "6-axis IMU", First: 0x68, Last: 0x69, ID: &ChipID{Register: 0x00, Value: 0xD1}},
+	{Name: "LSM6DS3", Description: "6-axis IMU", First: 0x6A, Last: 0x6B, ID: &ChipID{Register: 0x0F, Value: 0x69}},
+	{Name: "BNO055", Description: "9-axis IMU with sensor fusion", First: 0x28, Last: 0x29, ID: &ChipID{Register: 0x00, Value: 0xA0}},
+}
+
+// Candidates returns the known parts which can use the address
+func Candidates(address uint8) []Signature {
+	candidates := []Signature{}
+	for _, signature := range Signatures {
+		if address >= signature.First && address <= signature.Last {
+			candidates = append(candidates, signature)
+		}
+	}
+	return candidates
+}
+
+// Identify returns the known parts which can be at the address, parts with a chip id
+// are only returned if the device holds it. Identified parts come first.
+func (b *Bus) Identify(address uint8) []Signature {
+	identified := []Signature{}
+	possible := []Signature{}
+	for _, signature := range Candidates(address) {
+		if signature.ID == nil {
+			possible = append(possible, signature)
+			continue
+		}
+		if id, err := b.ReadByte(address, signature.ID.Register); err == nil && id == signature.ID.Value {
+			identified = append(identified, signature)
+		}
+	}
+	return append(identified, possible...)
+}
@@ -0,0 +1,22 @@
+package i2c
+
+import "testing"
+
+func TestCandidates(t *testing.T) {
+	names := func(signatures []Signature) []string {
+		names := []string{}
+		for _, signature := range signatures {
+			names = append(names, signature.Name)
+		}
+		return names
+	}
+	if candidates := names(Candidates(0x41)); len(candidates) != 2 || candidates[0] != "INA219" || candidates[1] != "PCA9685" {
+		t.Errorf("unexpected candidates %v", candidates)
+	}
+	if candidates := names(Candidates(0x3C)); len(candidates) != 2 {
+		t.Errorf("unexpected candidates %v", candidates)
+	}
+	if candidates := Candidates(0x10); len(candidates) != 0 {
+		t.Errorf("unexpected candidates %v", candidates)
+	}
+}
@@ -0,0 +1,360 @@
+package i2c
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// based on: http://smbus.org/specs/SMBus_3_1_20180319.pdf and linux/i2c.h
+
+type Functionality uint64
+
+const (
+	FUNC_I2C                    Functionality = 0x00000001
+	FUNC_10BIT_ADDR             Functionality = 0x00000002
+	FUNC_PROTOCOL_MANGLING      Functionality = 0x00000004
+	FUNC_SMBUS_PEC              Functionality = 0x00000008
+	FUNC_NOSTART                Functionality = 0x00000010
+	FUNC_SLAVE                  Functionality = 0x00000020
+	FUNC_SMBUS_BLOCK_PROC_CALL  Functionality = 0x00008000
+	FUNC_SMBUS_QUICK            Functionality = 0x00010000
+	FUNC_SMBUS_READ_BYTE        Functionality = 0x00020000
+	FUNC_SMBUS_WRITE_BYTE       Functionality = 0x00040000
+	FUNC_SMBUS_READ_BYTE_DATA   Functionality = 0x00080000
+	FUNC_SMBUS_WRITE_BYTE_DATA  Functionality = 0x00100000
+	FUNC_SMBUS_READ_WORD_DATA   Functionality = 0x00200000
+	FUNC_SMBUS_WRITE_WORD_DATA  Functionality = 0x00400000
+	FUNC_SMBUS_PROC_CALL        Functionality = 0x00800000
+	FUNC_SMBUS_READ_BLOCK_DATA  Functionality = 0x01000000
+	FUNC_SMBUS_WRITE_BLOCK_DATA Functionality = 0x02000000
+	FUNC_SMBUS_READ_I2C_BLOCK   Functionality = 0x04000000
+	FUNC_SMBUS_WRITE_I2C_BLOCK  Functionality = 0x08000000
+	FUNC_SMBUS_HOST_NOTIFY      Functionality = 0x10000000
+)
+
+var functionalityNames = []struct {
+	f    Functionality
+	name string
+}{
+	{FUNC_I2C, "i2c"},
+	{FUNC_10BIT_ADDR, "10bit-addr"},
+	{FUNC_PROTOCOL_MANGLING, "protocol-mangling"},
+	{FUNC_SMBUS_PEC, "pec"},
+	{FUNC_NOSTART, "nostart"},
+	{FUNC_SLAVE, "slave"},
+	{FUNC_SMBUS_BLOCK_PROC_CALL, "block-proc-call"},
+	{FUNC_SMBUS_QUICK, "quick"},
+	{FUNC_SMBUS_READ_BYTE, "read-byte"},
+	{FUNC_SMBUS_WRITE_BYTE, "write-byte"},
+	{FUNC_SMBUS_READ_BYTE_DATA, "read-byte-data"},
+	{FUNC_SMBUS_WRITE_BYTE_DATA, "write-byte-data"},
+	{FUNC_SMBUS_READ_WORD_DATA, "read-word-data"},
+	{FUNC_SMBUS_WRITE_WORD_DATA, "write-word-data"},
+	{FUNC_SMBUS_PROC_CALL, "proc-call"},
+	{FUNC_SMBUS_READ_BLOCK_DATA, "read-block-data"},
+	{FUNC_SMBUS_WRITE_BLOCK_DATA, "write-block-data"},
+	{FUNC_SMBUS_READ_I2C_BLOCK, "read-i2c-block"},
+	{FUNC_SMBUS_WRITE_I2C_BLOCK, "write-i2c-block"},
+	{FUNC_SMBUS_HOST_NOTIFY, "host-notify"},
+}
+
+// Has tells if all the given functionalities are supported
+func (f Functionality) Has(functionality Functionality) bool {
+	return f&functionality == functionality
+}
+
+func (f Functionality) String() string {
+	names := []string{}
+	for _, n := range functionalityNames {
+		if f.Has(n.f) {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+const SMBUS_BLOCK_MAX = 32
+
+var ErrPEC = errors.New("packet error code mismatch")
+var ErrBlockLength = errors.New("invalid block length")
+var ErrNoPEC = errors.New("adapter supports neither pec nor plain i2c")
+
+// PEC returns the SMBus Packet Error Code, a CRC-8 with polynomial x^8 + x^2 + x + 1,
+// of the bytes continuing from a previous crc, 0 for a new packet
+func PEC(crc uint8, data ...byte) uint8 {
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+const (
+	smbusWrite uint8 = 0
+	smbusRead  uint8 = 1
+)
+
+const (
+	smbusQuick         uint32 = 0
+	smbusByte          uint32 = 1
+	smbusByteData      uint32 = 2
+	smbusWordData      uint32 = 3
+	smbusProcCall      uint32 = 4
+	smbusBlockData     uint32 = 5
+	smbusBlockProcCall uint32 = 7
+)
+
+// smbusData is the union i2c_smbus_data of the kernel: a byte, a word or a block prefixed by its length
+type smbusData [SMBUS_BLOCK_MAX + 2]byte
+
+// SMBus talks to one device with the SMBus protocols, through the I2C_SMBUS ioctl
+// or, when PEC is enabled but the adapter does not support it, as plain i2c transfers
+// with the PEC computed here.
+type SMBus struct {
+	bus         *Bus
+	address     uint8
+	pec         bool
+	softwarePEC bool
+}
+
+func NewSMBus(bus *Bus, address uint8) *SMBus {
+	return &SMBus{
+		bus:     bus,
+		address: address,
+	}
+}
+
+func (s *SMBus) Address() uint8 {
+	return s.address
+}
+
+// SetPEC enables Packet Error Checking, in software if the adapter does not support it
+func (s *SMBus) SetPEC(enable bool) error {
+	s.pec = false
+	s.softwarePEC = false
+	if !enable {
+		return nil
+	}
+	funcs, err := s.bus.Functionality()
+	if err != nil {
+		return fmt.Errorf("unable to enable pec for smbus device 0x%02x: %w", s.address, err)
+	}
+	if !funcs.Has(FUNC_SMBUS_PEC) {
+		if !funcs.Has(FUNC_I2C) {
+			return fmt.Errorf("unable to enable pec for smbus device 0x%02x: %w", s.address, ErrNoPEC)
+		}
+		s.softwarePEC = true
+	}
+	s.pec = true
+	return nil
+}
+
+// PEC tells if Packet Error Checking is enabled and if it is done in software
+func (s *SMBus) PEC() (enabled bool, software bool) {
+	return s.pec, s.softwarePEC
+}
+
+// Quick sends only the address with the read/write bit, e.g. to switch a device on or off.
+// It never carries a PEC.
+func (s *SMBus) Quick(read bool) error {
+	readWrite := smbusWrite
+	if read {
+		readWrite = smbusRead
+	}
+	return s.wrap("quick command", 0, s.bus.smbusXfer(s.address, false, readWrite, 0, smbusQuick, nil))
+}
+
+func (s *SMBus) ReceiveByte() (uint8, error) {
+	if s.softwarePEC {
+		buf, err := s.emulate(nil, 1)
+		if err != nil {
+			return 0, s.wrap("receive byte", 0, err)
+		}
+		return buf[0], nil
+	}
+	data := smbusData{}
+	err := s.bus.smbusXfer(s.address, s.pec, smbusRead, 0, smbusByte, &data)
+	return data[0], s.wrap("receive byte", 0, err)
+}
+
+func (s *SMBus) SendByte(data uint8) error {
+	if s.softwarePEC {
+		_, err := s.emulate([]byte{data}, 0)
+		return s.wrap("send byte", data, err)
+	}
+	return s.wrap("send byte", data, s.bus.smbusXfer(s.address, s.pec, smbusWrite, data, smbusByte, nil))
+}
+
+func (s *SMBus) ReadByteData(command uint8) (uint8, error) {
+	if s.softwarePEC {
+		buf, err := s.emulate([]byte{command}, 1)
+		if err != nil {
+			return 0, s.wrap("read byte data", command, err)
+		}
+		return buf[0], nil
+	}
+	data := smbusData{}
+	err := s.bus.smbusXfer(s.address, s.pec, smbusRead, command, smbusByteData, &data)
+	return data[0], s.wrap("read byte data", command, err)
+}
+
+func (s *SMBus) WriteByteData(command uint8, value uint8) error {
+	if s.softwarePEC {
+		_, err := s.emulate([]byte{command, value}, 0)
+		return s.wrap("write byte data", command, err)
+	}
+	data := smbusData{value}
+	return s.wrap("write byte data", command, s.bus.smbusXfer(s.address, s.pec, smbusWrite, command, smbusByteData, &data))
+}
+
+// ReadWordData reads a word, SMBus sends the least significant byte first
+func (s *SMBus) ReadWordData(command uint8) (uint16, error) {
+	if s.softwarePEC {
+		buf, err := s.emulate([]byte{command}, 2)
+		if err != nil {
+			return 0, s.wrap("read word data", command, err)
+		}
+		return binary.LittleEndian.Uint16(buf), nil
+	}
+	data := smbusData{}
+	err := s.bus.smbusXfer(s.address, s.pec, smbusRead, command, smbusWordData, &data)
+	return binary.NativeEndian.Uint16(data[:]), s.wrap("read word data", command, err)
+}
+
+func (s *SMBus) WriteWordData(command uint8, value uint16) error {
+	if s.softwarePEC {
+		_, err := s.emulate(binary.LittleEndian.AppendUint16([]byte{command}, value), 0)
+		return s.wrap("write word data", command, err)
+	}
+	data := smbusData{}
+	binary.NativeEndian.PutUint16(data[:], value)
+	return s.wrap("write word data", command, s.bus.smbusXfer(s.address, s.pec, smbusWrite, command, smbusWordData, &data))
+}
+
+// ProcessCall writes a word and reads the answer of the device in the same transfer
+func (s *SMBus) ProcessCall(command uint8, value uint16) (uint16, error) {
+	if s.softwarePEC {
+		buf, err := s.emulate(binary.LittleEndian.AppendUint16([]byte{command}, value), 2)
+		if err != nil {
+			return 0, s.wrap("process call", command, err)
+		}
+		return binary.LittleEndian.Uint16(buf), nil
+	}
+	data := smbusData{}
+	binary.NativeEndian.PutUint16(data[:], value)
+	err := s.bus.smbusXfer(s.address, s.pec, smbusWrite, command, smbusProcCall, &data)
+	return binary.NativeEndian.Uint16(data[:]), s.wrap("process call", command, err)
+}
+
+// ReadBlockData reads a block of up to SMBUS_BLOCK_MAX bytes, the device tells its length
+func (s *SMBus) ReadBlockData(command uint8) ([]byte, error) {
+	if s.softwarePEC {
+		buf, err := s.emulate([]byte{command}, -1)
+		return buf, s.wrap("read block data", command, err)
+	}
+	data := smbusData{}
+	if err := s.bus.smbusXfer(s.address, s.pec, smbusRead, command, smbusBlockData, &data); err != nil {
+		return nil, s.wrap("read block data", command, err)
+	}
+	return block(data)
+}
+
+func (s *SMBus) WriteBlockData(command uint8, value []byte) error {
+	if len(value) == 0 || len(value) > SMBUS_BLOCK_MAX {
+		return s.wrap("write block data", command, fmt.Errorf("%w: %d", ErrBlockLength, len(value)))
+	}
+	if s.softwarePEC {
+		_, err := s.emulate(append([]byte{command, uint8(len(value))}, value...), 0)
+		return s.wrap("write block data", command, err)
+	}
+	data := smbusData{uint8(len(value))}
+	copy(data[1:], value)
+	return s.wrap("write block data", command, s.bus.smbusXfer(s.address, s.pec, smbusWrite, command, smbusBlockData, &data))
+}
+
+// BlockProcessCall writes a block and reads the block the device answers in the same transfer
+func (s *SMBus) BlockProcessCall(command uint8, value []byte) ([]byte, error) {
+	if len(value) == 0 || len(value) > SMBUS_BLOCK_MAX {
+		return nil, s.wrap("block process call", command, fmt.Errorf("%w: %d", ErrBlockLength, len(value)))
+	}
+	if s.softwarePEC {
+		buf, err := s.emulate(append([]byte{command, uint8(len(value))}, value...), -1)
+		return buf, s.wrap("block process call", command, err)
+	}
+	data := smbusData{uint8(len(value))}
+	copy(data[1:], value)
+	if err := s.bus.smbusXfer(s.address, s.pec, smbusWrite, command, smbusBlockProcCall, &data); err != nil {
+		return nil, s.wrap("block process call", command, err)
+	}
+	return block(data)
+}
+
+func block(data smbusData) ([]byte, error) {
+	length := int(data[0])
+	if length == 0 || length > SMBUS_BLOCK_MAX {
+		return nil, fmt.Errorf("%w: %d", ErrBlockLength, length)
+	}
+	return append([]byte(nil), data[1:1+length]...), nil
+}
+
+// emulate runs an SMBus protocol as plain i2c messages with a PEC byte: it writes w,
+// then reads n bytes, or a block prefixed by its length if n is negative
+func (s *SMBus) emulate(w []byte, n int) ([]byte, error) {
+	return emulate(s.bus, s.address, w, n)
+}
+
+// emulate reads a block in two transfers: the length byte, then the block and its PEC,
+// which the device sends on from where the first read stopped
+func emulate(conn Conn, address uint8, w []byte, n int) ([]byte, error) {
+	write := address << 1
+	read := write | 1
+	if n == 0 {
+		pec := PEC(PEC(0, write), w...)
+		return nil, conn.Transfer(Msg{Address: address, Buf: append(w, pec)})
+	}
+	length := n + 1
+	if n < 0 {
+		length = 1
+	}
+	r := make([]byte, length)
+	msgs := []Msg{{Address: address, Read: true, Buf: r}}
+	pec := PEC(0, read)
+	if len(w) > 0 {
+		msgs = append([]Msg{{Address: address, Buf: w}}, msgs...)
+		pec = PEC(PEC(PEC(0, write), w...), read)
+	}
+	if err := conn.Transfer(msgs...); err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		if r[0] == 0 || r[0] > SMBUS_BLOCK_MAX {
+			return nil, fmt.Errorf("%w: %d", ErrBlockLength, r[0])
+		}
+		pec = PEC(pec, r[0])
+		n = int(r[0])
+		r = make([]byte, n+1)
+		if err := conn.Transfer(Msg{Address: address, Read: true, Buf: r}); err != nil {
+			return nil, err
+		}
+	}
+	data := r[:n]
+	if expected := PEC(pec, data...); r[n] != expected {
+		return nil, fmt.Errorf("%w: got 0x%02x, expected 0x%02x", ErrPEC, r[n], expected)
+	}
+	return data, nil
+}
+
+func (s *SMBus) wrap(operation string, command uint8, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("unable to %s 0x%02x with smbus device 0x%02x: %w", operation, command, s.address, err)
+}
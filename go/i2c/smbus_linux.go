@@ -0,0 +1,64 @@
+//go:build linux
+// +build linux
+
+package i2c
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	I2C_SLAVE = 0x0703
+	I2C_FUNCS = 0x0705
+	I2C_PEC   = 0x0708
+	I2C_SMBUS = 0x0720
+)
+
+type i2cSmbusIoctlData struct {
+	readWrite uint8
+	command   uint8
+	size      uint32
+	data      uintptr
+}
+
+// Functionality queries what the adapter supports
+func (b *Bus) Functionality() (Functionality, error) {
+	var funcs uint64
+	if err := ioctl(b.f.Fd(), I2C_FUNCS, uintptr(unsafe.Pointer(&funcs))); err != nil {
+		return 0, err
+	}
+	return Functionality(funcs), nil
+}
+
+// smbusXfer selects the device and the PEC mode of the file, which are shared
+// by all its users, then runs the SMBus protocol
+func (b *Bus) smbusXfer(address uint8, pec bool, readWrite uint8, command uint8, size uint32, data *smbusData) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fd := b.f.Fd()
+	if err := ioctl(fd, I2C_SLAVE, uintptr(address)); err != nil {
+		return err
+	}
+	enable := uintptr(0)
+	if pec {
+		enable = 1
+	}
+	if err := ioctl(fd, I2C_PEC, enable); err != nil {
+		return err
+	}
+	args := i2cSmbusIoctlData{
+		readWrite: readWrite,
+		command:   command,
+		size:      size,
+		data:      uintptr(unsafe.Pointer(data)),
+	}
+	return ioctl(fd, I2C_SMBUS, uintptr(unsafe.Pointer(&args)))
+}
+
+func ioctl(fd uintptr, request uintptr, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package i2c
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPEC(t *testing.T) {
+	// CRC-8 check value of the SMBus polynomial
+	if pec := PEC(0, []byte("123456789")...); pec != 0xF4 {
+		t.Errorf("unexpected pec 0x%02x", pec)
+	}
+	if pec := PEC(PEC(0, []byte("1234")...), []byte("56789")...); pec != 0xF4 {
+		t.Errorf("unexpected continued pec 0x%02x", pec)
+	}
+}
+
+func TestFunctionality(t *testing.T) {
+	funcs := FUNC_I2C | FUNC_SMBUS_QUICK | FUNC_SMBUS_READ_BLOCK_DATA
+	if !funcs.Has(FUNC_I2C|FUNC_SMBUS_QUICK) || funcs.Has(FUNC_SMBUS_PEC) {
+		t.Errorf("unexpected functionality %s", funcs)
+	}
+	if s := funcs.String(); s != "i2c,quick,read-block-data" {
+		t.Errorf("unexpected string %s", s)
+	}
+}
+
+// scriptedConn answers the read messages with the scripted bytes, in order, and records the transfers
+type scriptedConn struct {
+	reads     [][]byte
+	transfers [][]Msg
+}
+
+func (c *scriptedConn) Transfer(msgs ...Msg) error {
+	transfer := []Msg{}
+	for _, msg := range msgs {
+		if msg.Read {
+			copy(msg.Buf, c.reads[0])
+			c.reads = c.reads[1:]
+		}
+		msg.Buf = append([]byte(nil), msg.Buf...)
+		transfer = append(transfer, msg)
+	}
+	c.transfers = append(c.transfers, transfer)
+	return nil
+}
+
+func TestEmulateWrite(t *testing.T) {
+	conn := &scriptedConn{}
+	if _, err := emulate(conn, 0x0B, []byte{0x10, 0x34, 0x12}, 0); err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x10, 0x34, 0x12, PEC(0, 0x16, 0x10, 0x34, 0x12)}
+	if len(conn.transfers) != 1 || !bytes.Equal(conn.transfers[0][0].Buf, expected) {
+		t.Errorf("unexpected transfers %+v", conn.transfers)
+	}
+}
+
+func TestEmulateRead(t *testing.T) {
+	tests := []struct {
+		name     string
+		w        []byte
+		n        int
+		reads    [][]byte
+		expected []byte
+		msgs     []int // length of the messages of each transfer
+	}{
+		{"byte", nil, 1, [][]byte{{0x42, PEC(0, 0x17, 0x42)}}, []byte{0x42}, []int{2}},
+		{"word", []byte{0x08}, 2, [][]byte{{0x34, 0x12, PEC(0, 0x16, 0x08, 0x17, 0x34, 0x12)}}, []byte{0x34, 0x12}, []int{1, 3}},
+		{"block", []byte{0x20}, -1, [][]byte{{3}, {0xA, 0xB, 0xC, PEC(0, 0x16, 0x20, 0x17, 3, 0xA, 0xB, 0xC)}}, []byte{0xA, 0xB, 0xC}, []int{1, 1, 4}},
+	}
+	for _, test := range tests {
+		conn := &scriptedConn{reads: test.reads}
+		data, err := emulate(conn, 0x0B, test.w, test.n)
+		if err != nil || !bytes.Equal(data, test.expected) {
+			t.Errorf("%s: unexpected data % x: %v", test.name, data, err)
+		}
+		msgs := []int{}
+		for _, transfer := range conn.transfers {
+			for _, msg := range transfer {
+				msgs = append(msgs, len(msg.Buf))
+			}
+		}
+		if len(msgs) != len(test.msgs) {
+			t.Errorf("%s: unexpected messages %v", test.name, msgs)
+			continue
+		}
+		for i := range msgs {
+			if msgs[i] != test.msgs[i] {
+				t.Errorf("%s: unexpected messages %v", test.name, msgs)
+				break
+			}
+		}
+	}
+}
+
+func TestEmulateErrors(t *testing.T) {
+	conn := &scriptedConn{reads: [][]byte{{0x34, 0x12, 0x00}}}
+	if _, err := emulate(conn, 0x0B, []byte{0x08}, 2); !errors.Is(err, ErrPEC) {
+		t.Errorf("expected a pec mismatch, got %v", err)
+	}
+	conn = &scriptedConn{reads: [][]byte{{3}, {0xA, 0xB, 0xC, 0x00}}}
+	if _, err := emulate(conn, 0x0B, []byte{0x20}, -1); !errors.Is(err, ErrPEC) {
+		t.Errorf("expected a block pec mismatch, got %v", err)
+	}
+	// the block is not read after an invalid length
+	conn = &scriptedConn{reads: [][]byte{{SMBUS_BLOCK_MAX + 1}}}
+	if _, err := emulate(conn, 0x0B, []byte{0x20}, -1); !errors.Is(err, ErrBlockLength) || len(conn.transfers) != 1 {
+		t.Errorf("expected an invalid block length, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package i2c
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// TRACE_ENV makes Open record the transfers of the bus to the file it names, see Tracer.
+// Only the I2C_RDWR transfers are recorded, the SMBus traffic of Scan and SMBus handles, see NewSMBus, is not.
+const TRACE_ENV = "I2C_TRACE"
+
+const traceHeader = "# i2c trace "
+
+// Tracer writes one line per transfer: the microseconds since the trace started,
+// the messages and the result, an errno or 0 for success, -1 for other errors.
+// A message is its direction, w or r, the address and the bytes written or read in hex:
+//
+//	# i2c trace 2024-05-01T10:00:00.000000001Z
+//	1532 w41:02 r41:2ef2 0
+//	2540 w41:050800 121
+type Tracer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	start  time.Time
+	err    error
+}
+
+// NewTracer writes the trace header to w
+func NewTracer(w io.Writer) *Tracer {
+	t := &Tracer{
+		w:     w,
+		start: time.Now(),
+	}
+	_, t.err = fmt.Fprintf(w, "%s%s\n", traceHeader, t.start.UTC().Format(time.RFC3339Nano))
+	return t
+}
+
+// CreateTracer traces to a new file, Close closes it
+func CreateTracer(path string) (*Tracer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create i2c trace: %w", err)
+	}
+	t := NewTracer(f)
+	t.closer = f
+	return t, nil
+}
+
+func (b *Bus) traceFromEnv() error {
+	path := os.Getenv(TRACE_ENV)
+	if path == "" {
+		return nil
+	}
+	tracer, err := CreateTracer(path)
+	if err != nil {
+		return err
+	}
+	b.tracer = tracer
+	return nil
+}
+
+// Record writes the line of a transfer, the first write error stops the trace and is returned by Close
+func (t *Tracer) Record(msgs []Msg, err error) {
+	line := strconv.AppendInt(nil, time.Since(t.start).Microseconds(), 10)
+	for _, msg := range msgs {
+		direction := byte('w')
+		if msg.Read {
+			direction = 'r'
+		}
+		line = append(line, ' ', direction)
+		line = append(line, hex.EncodeToString([]byte{msg.Address})...)
+		line = append(line, ':')
+		line = append(line, hex.EncodeToString(msg.Buf)...)
+	}
+	line = append(line, ' ')
+	line = strconv.AppendInt(line, traceResult(err), 10)
+	line = append(line, '\n')
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return
+	}
+	_, t.err = t.w.Write(line)
+}
+
+func (t *Tracer) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.err
+	if t.closer != nil {
+		err = errors.Join(err, t.closer.Close())
+	}
+	return err
+}
+
+func traceResult(err error) int64 {
+	if err == nil {
+		return 0
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return int64(errno)
+	}
+	return -1
+}
+
+// Trace records the transfers of any connection, e.g. a Shared bus
+func Trace(conn Conn, tracer *Tracer) Conn {
+	return &tracedConn{conn: conn, tracer: tracer}
+}
+
+type tracedConn struct {
+	conn   Conn
+	tracer *Tracer
+}
+
+func (c *tracedConn) Transfer(msgs ...Msg) error {
+	err := c.conn.Transfer(msgs...)
+	c.tracer.Record(msgs, err)
+	return err
+}
@@ -0,0 +1,88 @@
+package i2c_test
+
+import (
+	"bbai64/hwtest"
+	"bbai64/i2c"
+	"bbai64/ina219"
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTraceReplay(t *testing.T) {
+	bus := hwtest.NewI2CBus()
+	model := hwtest.NewINA219()
+	bus.Attach(ina219.ADDRESS_DEFAULT, model)
+	model.SetVoltages(0.01, 12)
+	trace := &bytes.Buffer{}
+	tracer := i2c.NewTracer(trace)
+	conn := i2c.Trace(bus, tracer)
+
+	sensor := ina219.New(i2c.NewDevice(conn, ina219.ADDRESS_DEFAULT))
+	if err := sensor.SetCalibration32Volts2Amps(); err != nil {
+		t.Fatal(err)
+	}
+	bus.Fail(ina219.ADDRESS_DEFAULT, hwtest.ErrNACK, 1)
+	if _, err := sensor.ReadBusVoltage(); err == nil {
+		t.Fatal("expected a nack")
+	}
+	recorded, err := sensor.ReadBusVoltage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i2c.NewDevice(conn, 0x68).ReadRegs(0x75, make([]byte, 1))
+	if err := tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(trace.String()), "\n")
+	if len(lines) != 6 || !strings.HasPrefix(lines[0], "# i2c trace ") {
+		t.Fatalf("unexpected trace\n%s", trace)
+	}
+	if !regexp.MustCompile(`^\d+ w41:02 r41:0000 121$`).MatchString(lines[3]) ||
+		!regexp.MustCompile(`^\d+ w41:02 r41:5dc2 0$`).MatchString(lines[4]) ||
+		!regexp.MustCompile(`^\d+ w68:75 r68:00 6$`).MatchString(lines[5]) {
+		t.Errorf("unexpected transfers\n%s", trace)
+	}
+
+	// the transfers with other devices are left out
+	replay, err := i2c.LoadReplay(strings.NewReader(trace.String()), ina219.ADDRESS_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.Remaining() != 4 {
+		t.Errorf("unexpected recorded transfers %d", replay.Remaining())
+	}
+	sensor = ina219.New(i2c.NewDevice(replay, ina219.ADDRESS_DEFAULT))
+	if _, err := sensor.ReadShuntVoltage(); !errors.Is(err, i2c.ErrReplayMismatch) {
+		t.Errorf("expected a mismatch, got %v", err)
+	}
+	if err := sensor.SetCalibration32Volts2Amps(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sensor.ReadBusVoltage(); !errors.Is(err, hwtest.ErrNACK) {
+		t.Errorf("expected the recorded nack, got %v", err)
+	}
+	if voltage, err := sensor.ReadBusVoltage(); err != nil || voltage != recorded {
+		t.Errorf("unexpected replayed voltage %f: %v", voltage, err)
+	}
+	if _, err := sensor.ReadBusVoltage(); !errors.Is(err, i2c.ErrReplayEnd) {
+		t.Errorf("expected the end of the recording, got %v", err)
+	}
+}
+
+func TestLoadReplayErrors(t *testing.T) {
+	for _, trace := range []string{
+		"12 w41:02",
+		"12 x41:02 0",
+		"12 w4:02 0",
+		"12 w41:0 0",
+		"t w41:02 0",
+	} {
+		if _, err := i2c.LoadReplay(strings.NewReader(trace)); err == nil {
+			t.Errorf("expected %q to be rejected", trace)
+		}
+	}
+}
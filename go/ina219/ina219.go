@@ -1,6 +1,10 @@
 package ina219
 
-import "bbai64/i2c"
+import (
+	"bbai64/i2c"
+	"encoding/binary"
+	"fmt"
+)
 
 // based on: https://www.waveshare.com/wiki/UPS_Module_3S
 
@@ -63,16 +67,15 @@ const (
 const ADDRESS_DEFAULT uint8 = 0x41
 
 type INA219 struct {
-	bus        *i2c.Bus
-	address    uint8
+	device     i2c.Device
 	currentLSB float64
 	powerLSB   float64
 }
 
-func New(bus *i2c.Bus, address uint8) *INA219 {
+// New takes the device, e.g. bus.Device(ADDRESS_DEFAULT)
+func New(device i2c.Device) *INA219 {
 	return &INA219{
-		bus:     bus,
-		address: address,
+		device: device,
 	}
 }
 
@@ -83,7 +86,7 @@ func (i *INA219) SetCalibration32Volts2Amps() error {
 	i.currentLSB = 0.1 // Current LSB = 100uA per bit
 	i.powerLSB = 2     // Power LSB = 2mW per bit
 	var calibrationValue uint16 = 4096
-	if err := i.bus.WriteWord(i.address, uint8(REG_CALIBRATION), calibrationValue); err != nil {
+	if err := i.writeRegister(REG_CALIBRATION, calibrationValue); err != nil {
 		return err
 	}
 	return i.writeConfig(RANGE_32V, DIV_8_320MV, ADCRES_12BIT_32S, ADCRES_12BIT_32S, SANDBVOLT_CONTINUOUS)
@@ -100,11 +103,11 @@ func (i *INA219) writeConfig(
 		uint16(busADCResolution<<7) |
 		uint16(shuntADCResolution<<3) |
 		uint16(mode)
-	return i.bus.WriteWord(i.address, uint8(REG_CONFIG), config)
+	return i.writeRegister(REG_CONFIG, config)
 }
 
 func (i *INA219) ReadShuntVoltage() (float64, error) {
-	value, err := i.bus.ReadWord(i.address, uint8(REG_SHUNT_VOLTAGE))
+	value, err := i.readRegister(REG_SHUNT_VOLTAGE)
 	if err != nil {
 		return 0, err
 	}
@@ -113,7 +116,7 @@ func (i *INA219) ReadShuntVoltage() (float64, error) {
 }
 
 func (i *INA219) ReadBusVoltage() (float64, error) {
-	value, err := i.bus.ReadWord(i.address, uint8(REG_BUS_VOLTAGE))
+	value, err := i.readRegister(REG_BUS_VOLTAGE)
 	if err != nil {
 		return 0, err
 	}
@@ -122,7 +125,7 @@ func (i *INA219) ReadBusVoltage() (float64, error) {
 }
 
 func (i *INA219) ReadCurrent() (float64, error) {
-	value, err := i.bus.ReadWord(i.address, uint8(REG_CURRENT))
+	value, err := i.readRegister(REG_CURRENT)
 	if err != nil {
 		return 0, err
 	}
@@ -131,10 +134,26 @@ func (i *INA219) ReadCurrent() (float64, error) {
 }
 
 func (i *INA219) ReadPower() (float64, error) {
-	value, err := i.bus.ReadWord(i.address, uint8(REG_POWER))
+	value, err := i.readRegister(REG_POWER)
 	if err != nil {
 		return 0, err
 	}
 	result := float64(int16(value)) * i.powerLSB / 1000
 	return result, nil
 }
+
+// registers are 16-bit, most significant byte first
+func (i *INA219) readRegister(reg Register) (uint16, error) {
+	buf := make([]byte, 2)
+	if err := i.device.ReadRegs(uint8(reg), buf); err != nil {
+		return 0, fmt.Errorf("unable to read ina219 register 0x%02x: %w", reg, err)
+	}
+	return binary.BigEndian.Uint16(buf), nil
+}
+
+func (i *INA219) writeRegister(reg Register, value uint16) error {
+	if err := i.device.WriteRegs(uint8(reg), binary.BigEndian.AppendUint16(nil, value)); err != nil {
+		return fmt.Errorf("unable to write ina219 register 0x%02x: %w", reg, err)
+	}
+	return nil
+}
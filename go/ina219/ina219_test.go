@@ -0,0 +1,68 @@
+package ina219
+
+import (
+	"bbai64/hwtest"
+	"bbai64/i2c"
+	"errors"
+	"math"
+	"testing"
+)
+
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestINA219(t *testing.T) {
+	bus := hwtest.NewI2CBus()
+	model := hwtest.NewINA219()
+	bus.Attach(ADDRESS_DEFAULT, model)
+	ina219 := New(i2c.NewDevice(bus, ADDRESS_DEFAULT))
+
+	if err := ina219.SetCalibration32Volts2Amps(); err != nil {
+		t.Fatal(err)
+	}
+	if calibration := model.Get(uint8(REG_CALIBRATION)); calibration != 4096 {
+		t.Errorf("unexpected calibration %d", calibration)
+	}
+	if config := model.Get(uint8(REG_CONFIG)); config != 0x3EEF {
+		t.Errorf("unexpected config 0x%04x", config)
+	}
+
+	// 1.23A flowing backward through the 0.1 ohm shunt
+	model.SetVoltages(-0.123, 11.5)
+	if shunt, err := ina219.ReadShuntVoltage(); err != nil || !near(shunt, -0.123) {
+		t.Errorf("unexpected shunt voltage %f: %v", shunt, err)
+	}
+	if bus, err := ina219.ReadBusVoltage(); err != nil || !near(bus, 11.5) {
+		t.Errorf("unexpected bus voltage %f: %v", bus, err)
+	}
+	if current, err := ina219.ReadCurrent(); err != nil || !near(current, -1.23) {
+		t.Errorf("unexpected current %f: %v", current, err)
+	}
+	if power, err := ina219.ReadPower(); err != nil || !near(power, 14.144) {
+		t.Errorf("unexpected power %f: %v", power, err)
+	}
+}
+
+func TestINA219Faults(t *testing.T) {
+	bus := hwtest.NewI2CBus()
+	bus.Attach(ADDRESS_DEFAULT, hwtest.NewINA219())
+	ina219 := New(i2c.NewDevice(bus, ADDRESS_DEFAULT))
+
+	bus.Fail(ADDRESS_DEFAULT, hwtest.ErrNACK, 1)
+	if err := ina219.SetCalibration32Volts2Amps(); !errors.Is(err, hwtest.ErrNACK) {
+		t.Errorf("expected a nack, got %v", err)
+	}
+	bus.Fail(ADDRESS_DEFAULT, hwtest.ErrTimeout, 1)
+	if _, err := ina219.ReadBusVoltage(); !errors.Is(err, hwtest.ErrTimeout) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if _, err := ina219.ReadBusVoltage(); err != nil {
+		t.Errorf("expected the fault to be over, got %v", err)
+	}
+
+	absent := New(i2c.NewDevice(bus, 0x40))
+	if _, err := absent.ReadShuntVoltage(); !errors.Is(err, hwtest.ErrAddressNACK) {
+		t.Errorf("expected the address not to be acknowledged, got %v", err)
+	}
+}
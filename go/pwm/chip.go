@@ -0,0 +1,124 @@
+package pwm
+
+import (
+	"bbai64/sysfs"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EXPORT_TIMEOUT is how long to wait for udev to make a freshly exported channel writable
+const EXPORT_TIMEOUT = time.Second
+
+var ErrChipNotFound = errors.New("pwm chip not found")
+
+var busNodesMutex sync.RWMutex
+
+// busNodes maps the bone buses to the device tree nodes of their EHRPWM instances,
+// the bone bus n defaults to the n-th EHRPWM of the J721E
+var busNodes = map[Bus]string{
+	Bus0: "3000000.pwm",
+	Bus1: "3010000.pwm",
+	Bus2: "3020000.pwm",
+}
+
+// SetBusNode changes the device tree node of the chip of a bus,
+// as "pwm@3000000" or as the platform device name "3000000.pwm"
+func SetBusNode(bus Bus, node string) {
+	busNodesMutex.Lock()
+	defer busNodesMutex.Unlock()
+	busNodes[bus] = node
+}
+
+func BusNode(bus Bus) (string, bool) {
+	busNodesMutex.RLock()
+	defer busNodesMutex.RUnlock()
+	node, ok := busNodes[bus]
+	return node, ok
+}
+
+// FindBusChip returns N of the /sys/class/pwm/pwmchipN driving the bus
+func FindBusChip(bus Bus) (int, error) {
+	node, ok := BusNode(bus)
+	if !ok {
+		return -1, fmt.Errorf("%w: no device tree node for bus %d", ErrChipNotFound, bus)
+	}
+	return FindChip(node)
+}
+
+// FindChip returns N of the /sys/class/pwm/pwmchipN whose device is the device tree node,
+// given as "pwm@3000000" or as "3000000.pwm"
+func FindChip(node string) (int, error) {
+	root := fsRoot.Root()
+	chips, _ := filepath.Glob(filepath.Join(root, "sys/class/pwm/pwmchip*"))
+	sort.Strings(chips)
+	want := platformDeviceName(node)
+	for _, chip := range chips {
+		device, err := filepath.EvalSymlinks(filepath.Join(chip, "device"))
+		if err != nil {
+			continue
+		}
+		if filepath.Base(device) != want {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(chip), "pwmchip"))
+		if err != nil {
+			continue
+		}
+		return number, nil
+	}
+	return -1, fmt.Errorf("%w: no pwmchip for %s under %s", ErrChipNotFound, node, root)
+}
+
+// platformDeviceName turns a node name like "pwm@3000000" into the device name "3000000.pwm"
+func platformDeviceName(node string) string {
+	name, address, ok := strings.Cut(node, "@")
+	if !ok {
+		return node
+	}
+	return address + "." + name
+}
+
+func channelIndex(channel Channel) (int, error) {
+	switch channel {
+	case ChannelA:
+		return 0, nil
+	case ChannelB:
+		return 1, nil
+	}
+	return -1, fmt.Errorf("unknown channel %q", channel)
+}
+
+// exportChannel exports the channel unless it already is, and tells if it did
+func exportChannel(fs sysfs.FS, chip int, index int) (string, bool, error) {
+	chipDir := fmt.Sprintf("/sys/class/pwm/pwmchip%d", chip)
+	dir := fmt.Sprintf("%s/pwm%d", chipDir, index)
+	if _, err := fs.Stat(dir); err == nil {
+		return dir, false, nil
+	}
+	if err := fs.WriteFile(chipDir+"/export", []byte(strconv.Itoa(index))); err != nil {
+		return "", false, err
+	}
+	// the attributes may show up a little after the export write returns
+	deadline := time.Now().Add(EXPORT_TIMEOUT)
+	for {
+		_, err := fs.Stat(dir + "/enable")
+		if err == nil {
+			return dir, true, nil
+		}
+		if time.Now().After(deadline) {
+			unexportChannel(fs, chip, index)
+			return "", false, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func unexportChannel(fs sysfs.FS, chip int, index int) error {
+	return fs.WriteFile(fmt.Sprintf("/sys/class/pwm/pwmchip%d/unexport", chip), []byte(strconv.Itoa(index)))
+}
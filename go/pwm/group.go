@@ -0,0 +1,185 @@
+package pwm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RAMP_STEP is how often a ramping group writes its duty cycles
+const RAMP_STEP = 10 * time.Millisecond
+
+// Group updates several channels together, e.g. the wheels of a robot.
+// With a ramp time a new duty cycle is reached linearly over that time on a background ticker,
+// except zero which is always written at once so stopping is never delayed.
+// A failed write stops the ramp, its error is returned by the next Set or Stop.
+type Group struct {
+	mu       sync.Mutex
+	channels []*PWM
+	ramp     time.Duration
+	written  []time.Duration // last duty cycles written, -1 if unknown
+	start    []time.Duration
+	target   []time.Duration
+	started  time.Time
+	ramping  bool          // the ramp goroutine is running
+	done     chan struct{} // closed when the ramp goroutine exits
+	rampErr  error         // the write error which stopped the ramp, not reported yet
+}
+
+func NewGroup(ramp time.Duration, channels ...*PWM) *Group {
+	g := &Group{
+		channels: channels,
+		ramp:     ramp,
+		written:  make([]time.Duration, len(channels)),
+		start:    make([]time.Duration, len(channels)),
+		target:   make([]time.Duration, len(channels)),
+	}
+	for i := range g.written {
+		g.written[i] = -1
+	}
+	return g
+}
+
+// SetRamp changes the ramp time, 0 writes new duty cycles at once
+func (g *Group) SetRamp(ramp time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ramp = ramp
+}
+
+// Set changes the duty cycles of all channels, in the order of the group.
+// The channels going to zero are written first, so two channels driving
+// the same motor in opposite directions never overlap.
+func (g *Group) Set(duties ...time.Duration) error {
+	if len(duties) != len(g.channels) {
+		return fmt.Errorf("unable to set pwm group: %d duty cycles for %d channels", len(duties), len(g.channels))
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.set(duties)
+}
+
+// set must be called with the lock held
+func (g *Group) set(duties []time.Duration) error {
+	copy(g.target, duties)
+	g.started = time.Now()
+	errs := []error{g.takeRampErr()}
+	for i, duty := range duties {
+		if duty == 0 {
+			errs = append(errs, g.write(i, 0))
+		}
+		g.start[i] = max(g.written[i], 0)
+	}
+	if g.ramp <= 0 {
+		for i, duty := range duties {
+			if duty != 0 {
+				errs = append(errs, g.write(i, duty))
+			}
+		}
+	}
+	if g.ramp > 0 && !g.ramping && !g.reached() {
+		g.ramping = true
+		g.done = make(chan struct{})
+		go g.run(g.done)
+	}
+	return errors.Join(errs...)
+}
+
+// Stop writes zero to all channels at once and waits for a ramp in progress to end
+func (g *Group) Stop() error {
+	g.mu.Lock()
+	err := g.set(make([]time.Duration, len(g.channels)))
+	done := g.done
+	g.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return errors.Join(err, g.takeRampErr())
+}
+
+// takeRampErr must be called with the lock held
+func (g *Group) takeRampErr() error {
+	err := g.rampErr
+	g.rampErr = nil
+	return err
+}
+
+// Duties returns the duty cycles written last, which lag the ones set while ramping
+func (g *Group) Duties() []time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	duties := make([]time.Duration, len(g.written))
+	for i, duty := range g.written {
+		duties[i] = max(duty, 0)
+	}
+	return duties
+}
+
+// Ramping tells if some channels did not reach their duty cycle yet
+func (g *Group) Ramping() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.ramping && !g.reached()
+}
+
+// write must be called with the lock held, unchanged duty cycles are not written
+func (g *Group) write(i int, duty time.Duration) error {
+	if g.written[i] == duty {
+		return nil
+	}
+	if err := g.channels[i].DutyCycle(duty); err != nil {
+		g.written[i] = -1
+		return fmt.Errorf("unable to set duty cycle of %s to %v: %w", g.channels[i], duty, err)
+	}
+	g.written[i] = duty
+	return nil
+}
+
+func (g *Group) reached() bool {
+	for i, duty := range g.target {
+		if g.written[i] != duty {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *Group) run(done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(RAMP_STEP)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if !g.step(now) {
+			return
+		}
+	}
+}
+
+// step writes the duty cycles on the way to the targets and tells if there is more to go
+func (g *Group) step(now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.reached() {
+		g.ramping = false
+		return false
+	}
+	progress := 1.0
+	if g.ramp > 0 {
+		progress = min(float64(now.Sub(g.started))/float64(g.ramp), 1)
+	}
+	errs := []error{}
+	for i, target := range g.target {
+		duty := g.start[i] + time.Duration(progress*float64(target-g.start[i]))
+		errs = append(errs, g.write(i, duty))
+	}
+	if err := errors.Join(errs...); err != nil {
+		g.rampErr = errors.Join(g.rampErr, err)
+		g.ramping = false
+		return false
+	}
+	g.ramping = progress < 1 && !g.reached()
+	return g.ramping
+}
@@ -1,8 +1,12 @@
 package pwm
 
 import (
+	"bbai64/gpio"
+	"bbai64/registry"
+	"bbai64/sysfs"
 	"fmt"
-	"os"
+	"path"
+	"sync"
 	"time"
 )
 
@@ -28,40 +32,159 @@ const (
 	PolarityInversed Polarity = "inversed"
 )
 
+var fsRoot sysfs.FS = sysfs.Host
+
+// SetFS makes the package use another root for /dev and /sys, e.g. a fake tree in tests.
+// It applies to every PWM, including the ones already created.
+func SetFS(fsys sysfs.FS) {
+	fsRoot = fsys
+}
+
+// PWM is a channel of either /dev/bone/pwm/<bus>/<channel>
+// or /sys/class/pwm/pwmchipN/pwmM when the bone symlinks are missing
 type PWM struct {
-	enable    string
-	dutyCycle string
-	period    string
-	polarity  string
+	mu       sync.Mutex
+	bus      Bus
+	channel  Channel
+	chip     int // -1 until known
+	index    int
+	dir      string
+	fs       sysfs.FS // the FS dir was resolved with
+	exported bool     // the channel was exported by us and gets unexported on release
+	claimed  bool     // the header pin is claimed in gpio.DefaultChecker
 }
 
+// NewPWM claims the channel, it is registered to be disabled by registry.ReleaseAll.
+// The channel is looked up on first use: /dev/bone/pwm if present,
+// otherwise the chip of the bus found by its device tree node, see SetBusNode.
+// Its header pin is claimed in gpio.DefaultChecker then, the first use fails if the pin is used otherwise.
 func NewPWM(bus Bus, channel Channel) *PWM {
-	return &PWM{
-		enable:    fmt.Sprintf("/dev/bone/pwm/%d/%s/enable", bus, channel),
-		dutyCycle: fmt.Sprintf("/dev/bone/pwm/%d/%s/duty_cycle", bus, channel),
-		period:    fmt.Sprintf("/dev/bone/pwm/%d/%s/period", bus, channel),
-		polarity:  fmt.Sprintf("/dev/bone/pwm/%d/%s/polarity", bus, channel),
+	pwm := &PWM{bus: bus, channel: channel, chip: -1}
+	registry.Register(pwm)
+	return pwm
+}
+
+// NewSysfsPWM exports /sys/class/pwm/pwmchip<chip>/pwm<index> and claims it
+func NewSysfsPWM(chip int, index int) (*PWM, error) {
+	pwm := &PWM{bus: -1, chip: chip, index: index}
+	if _, err := pwm.path(""); err != nil {
+		return nil, err
+	}
+	registry.Register(pwm)
+	return pwm, nil
+}
+
+func (pwm *PWM) String() string {
+	if pwm.bus >= 0 {
+		return fmt.Sprintf("pwm %d%s", pwm.bus, pwm.channel)
+	}
+	return fmt.Sprintf("pwmchip%d/pwm%d", pwm.chip, pwm.index)
+}
+
+// path returns the path of an attribute of the channel, exporting it when needed
+func (pwm *PWM) path(attr string) (string, error) {
+	pwm.mu.Lock()
+	defer pwm.mu.Unlock()
+	if pwm.dir == "" || pwm.fs != fsRoot {
+		if err := pwm.resolve(); err != nil {
+			return "", err
+		}
+	}
+	return path.Join(pwm.dir, attr), nil
+}
+
+func (pwm *PWM) resolve() error {
+	fs := fsRoot
+	if pwm.bus >= 0 && !pwm.claimed {
+		if err := gpio.DefaultChecker.ClaimFunction(gpio.FUNC_PWM, int(pwm.bus), string(pwm.channel)); err != nil {
+			return fmt.Errorf("unable to claim %s: %w", pwm, err)
+		}
+		pwm.claimed = true
+	}
+	if pwm.bus >= 0 && pwm.chip < 0 {
+		bone := fmt.Sprintf("/dev/bone/pwm/%d/%s", pwm.bus, pwm.channel)
+		if _, err := fs.Stat(bone); err == nil {
+			pwm.dir, pwm.fs = bone, fs
+			return nil
+		}
+		chip, err := FindBusChip(pwm.bus)
+		if err != nil {
+			return fmt.Errorf("unable to find %s: %w", pwm, err)
+		}
+		index, err := channelIndex(pwm.channel)
+		if err != nil {
+			return fmt.Errorf("unable to find %s: %w", pwm, err)
+		}
+		pwm.chip, pwm.index = chip, index
+	}
+	dir, exported, err := exportChannel(fs, pwm.chip, pwm.index)
+	if err != nil {
+		return fmt.Errorf("unable to export %s: %w", pwm, err)
+	}
+	pwm.dir, pwm.fs, pwm.exported = dir, fs, exported
+	return nil
+}
+
+// Unexport gives the channel back to the kernel if it was exported through /sys/class/pwm
+func (pwm *PWM) Unexport() error {
+	pwm.mu.Lock()
+	defer pwm.mu.Unlock()
+	if !pwm.exported {
+		return nil
+	}
+	if err := unexportChannel(pwm.fs, pwm.chip, pwm.index); err != nil {
+		return fmt.Errorf("unable to unexport %s: %w", pwm, err)
+	}
+	pwm.exported = false
+	pwm.dir = ""
+	return nil
+}
+
+// Release disables the channel and gives up the claim, a channel never used is left alone
+func (pwm *PWM) Release() error {
+	registry.Unregister(pwm)
+	pwm.mu.Lock()
+	used := pwm.dir != ""
+	if pwm.claimed {
+		gpio.DefaultChecker.ReleaseFunction(gpio.FUNC_PWM, int(pwm.bus), string(pwm.channel))
+		pwm.claimed = false
+	}
+	pwm.mu.Unlock()
+	if !used {
+		return nil
+	}
+	if err := pwm.Disable(); err != nil {
+		return fmt.Errorf("unable to release %s: %w", pwm, err)
+	}
+	return pwm.Unexport()
+}
+
+func (pwm *PWM) write(attr string, value []byte) error {
+	name, err := pwm.path(attr)
+	if err != nil {
+		return err
 	}
+	return fsRoot.WriteFile(name, value)
 }
 
 func (pwm *PWM) Enable() error {
-	return os.WriteFile(pwm.enable, []byte{'1'}, 0666)
+	return pwm.write("enable", []byte{'1'})
 }
 
 func (pwm *PWM) Disable() error {
-	return os.WriteFile(pwm.enable, []byte{'0'}, 0666)
+	return pwm.write("enable", []byte{'0'})
 }
 
 func (pwm *PWM) Polarity(polarity Polarity) error {
-	return os.WriteFile(pwm.polarity, []byte(polarity), 0666)
+	return pwm.write("polarity", []byte(polarity))
 }
 
 func (pwm *PWM) Period(period time.Duration) error {
 	value := fmt.Sprintf("%d", period.Nanoseconds())
-	return os.WriteFile(pwm.period, []byte(value), 0666)
+	return pwm.write("period", []byte(value))
 }
 
 func (pwm *PWM) DutyCycle(dutyCycle time.Duration) error {
 	value := fmt.Sprintf("%d", dutyCycle.Nanoseconds())
-	return os.WriteFile(pwm.dutyCycle, []byte(value), 0666)
+	return pwm.write("duty_cycle", []byte(value))
 }
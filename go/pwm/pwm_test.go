@@ -0,0 +1,227 @@
+package pwm
+
+import (
+	"bbai64/hwtest"
+	"bbai64/sysfs"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBonePWM(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddBonePWM(1, "b")
+	SetFS(tree)
+	defer SetFS(sysfs.Host)
+
+	pwm := NewPWM(Bus1, ChannelB)
+	defer pwm.Release()
+	if err := pwm.Period(20 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if period := tree.Read("/dev/bone/pwm/1/b/period"); period != "20000000" {
+		t.Errorf("unexpected period %s", period)
+	}
+}
+
+func TestSysfsClassPWM(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddPWMChip(0, "3040000.pwm", 2)
+	tree.AddPWMChip(2, "3000000.pwm", 2)
+	SetFS(tree)
+	defer SetFS(sysfs.Host)
+
+	if chip, err := FindChip("pwm@3000000"); err != nil || chip != 2 {
+		t.Errorf("unexpected chip %d: %v", chip, err)
+	}
+	if _, err := FindChip("pwm@3050000"); !errors.Is(err, ErrChipNotFound) {
+		t.Errorf("expected chip not found, got %v", err)
+	}
+
+	pwm := NewPWM(Bus0, ChannelB)
+	if err := pwm.Period(20 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := pwm.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	if exports := tree.WritesTo("/sys/class/pwm/pwmchip2/export"); len(exports) != 1 || exports[0] != "1" {
+		t.Errorf("unexpected exports %v", exports)
+	}
+	if tree.Read("/sys/class/pwm/pwmchip2/pwm1/period") != "20000000" || tree.Read("/sys/class/pwm/pwmchip2/pwm1/enable") != "1" {
+		t.Error("channel is not configured")
+	}
+	if err := pwm.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Exists("/sys/class/pwm/pwmchip2/pwm1") {
+		t.Error("expected the channel to be unexported")
+	}
+}
+
+func TestSysfsPWMAlreadyExported(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddPWMChip(3, "3010000.pwm", 2)
+	SetFS(tree)
+	defer SetFS(sysfs.Host)
+	if err := tree.WriteFile("/sys/class/pwm/pwmchip3/export", []byte("0")); err != nil {
+		t.Fatal(err)
+	}
+
+	pwm, err := NewSysfsPWM(3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pwm.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if !tree.Exists("/sys/class/pwm/pwmchip3/pwm0") {
+		t.Error("expected a channel exported by someone else to stay exported")
+	}
+}
+
+func TestApply(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddBonePWM(0, "a")
+	SetFS(tree)
+	defer SetFS(sysfs.Host)
+	pwm := NewPWM(Bus0, ChannelA)
+	defer pwm.Release()
+
+	servo := State{Period: 20 * time.Millisecond, Duty: 1500 * time.Microsecond, Polarity: PolarityInversed, Enabled: true}
+	if err := pwm.Apply(servo); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := pwm.State(); err != nil || state != servo {
+		t.Errorf("unexpected state %s: %v", state, err)
+	}
+
+	// a shorter period than the current duty cycle, with a polarity change while enabled
+	motor := State{Period: time.Millisecond, Duty: 400 * time.Microsecond, Polarity: PolarityNormal, Enabled: true}
+	tree.ResetWrites()
+	if err := pwm.Apply(motor); err != nil {
+		t.Fatal(err)
+	}
+	for _, write := range tree.Writes() {
+		if write.Err != nil {
+			t.Errorf("unexpected rejected write %+v", write)
+		}
+	}
+	if state, err := pwm.State(); err != nil || state != motor {
+		t.Errorf("unexpected state %s: %v", state, err)
+	}
+
+	tree.ResetWrites()
+	if err := pwm.Apply(motor); err != nil || len(tree.Writes()) != 0 {
+		t.Errorf("expected no writes for the same state, got %v: %v", tree.Writes(), err)
+	}
+	invalid := State{Period: time.Millisecond, Duty: 2 * time.Millisecond, Polarity: PolarityNormal}
+	if err := pwm.Apply(invalid); !errors.Is(err, ErrDutyExceedsPeriod) || len(tree.Writes()) != 0 {
+		t.Errorf("expected duty cycle exceeding period to be rejected without writes, got %v", err)
+	}
+	if err := pwm.Apply(State{Polarity: PolarityNormal, Enabled: true}); !errors.Is(err, ErrNoPeriod) {
+		t.Errorf("expected enabling without period to be rejected, got %v", err)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddBonePWM(0, "a")
+	tree.AddBonePWM(0, "b")
+	SetFS(tree)
+	defer SetFS(sysfs.Host)
+	forward := NewPWM(Bus0, ChannelA)
+	backward := NewPWM(Bus0, ChannelB)
+	defer forward.Release()
+	defer backward.Release()
+	for _, pwm := range []*PWM{forward, backward} {
+		if err := pwm.Apply(State{Period: time.Millisecond, Polarity: PolarityNormal, Enabled: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	group := NewGroup(0, forward, backward)
+	if err := group.Set(time.Millisecond); err == nil {
+		t.Error("expected a missing duty cycle to be rejected")
+	}
+	if err := group.Set(400*time.Microsecond, 0); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Read("/dev/bone/pwm/0/a/duty_cycle") != "400000" || tree.Read("/dev/bone/pwm/0/b/duty_cycle") != "0" {
+		t.Error("duty cycles are not written at once")
+	}
+
+	// the channel going to zero is written first
+	tree.ResetWrites()
+	group.Set(0, 200*time.Microsecond)
+	writes := tree.Writes()
+	if len(writes) != 2 || writes[0].Path != "/dev/bone/pwm/0/a/duty_cycle" || writes[1].Data != "200000" {
+		t.Errorf("unexpected writes %v", writes)
+	}
+	tree.ResetWrites()
+	group.Set(0, 200*time.Microsecond)
+	if len(tree.Writes()) != 0 {
+		t.Errorf("expected no writes for unchanged duty cycles, got %v", tree.Writes())
+	}
+
+	group.SetRamp(5 * RAMP_STEP)
+	if err := group.Set(0, 400*time.Microsecond); err != nil {
+		t.Fatal(err)
+	}
+	if !group.Ramping() || tree.Read("/dev/bone/pwm/0/b/duty_cycle") != "200000" {
+		t.Error("expected the duty cycle to ramp")
+	}
+	deadline := time.Now().Add(time.Second)
+	for group.Ramping() && time.Now().Before(deadline) {
+		time.Sleep(RAMP_STEP)
+	}
+	if duties := group.Duties(); duties[1] != 400*time.Microsecond {
+		t.Errorf("unexpected duty cycles %v", duties)
+	}
+	if writes := tree.WritesTo("/dev/bone/pwm/0/b/duty_cycle"); len(writes) < 3 {
+		t.Errorf("expected intermediate duty cycles, got %v", writes)
+	}
+
+	group.Set(0, 100*time.Microsecond)
+	if err := group.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Read("/dev/bone/pwm/0/b/duty_cycle") != "0" {
+		t.Error("expected zero to be written at once while ramping")
+	}
+}
+
+func TestGroupRampError(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddBonePWM(1, "a")
+	SetFS(tree)
+	defer SetFS(sysfs.Host)
+	pwm := NewPWM(Bus1, ChannelA)
+	defer pwm.Release()
+	if err := pwm.Apply(State{Period: time.Millisecond, Polarity: PolarityNormal, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the duty cycles on the way to the target exceed the period at some point
+	group := NewGroup(5*RAMP_STEP, pwm)
+	if err := group.Set(2 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for group.Ramping() && time.Now().Before(deadline) {
+		time.Sleep(RAMP_STEP)
+	}
+	if group.Ramping() {
+		t.Fatal("expected the failed write to stop the ramp")
+	}
+	if err := group.Stop(); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("expected the ramp error to be returned, got %v", err)
+	}
+	if err := group.Stop(); err != nil {
+		t.Errorf("expected the ramp error to be returned once, got %v", err)
+	}
+	if tree.Read("/dev/bone/pwm/1/a/duty_cycle") != "0" {
+		t.Error("expected the channel to be stopped")
+	}
+}
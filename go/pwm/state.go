@@ -0,0 +1,171 @@
+package pwm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrDutyExceedsPeriod = errors.New("duty cycle exceeds period")
+var ErrNegative = errors.New("negative period or duty cycle")
+var ErrNoPeriod = errors.New("enabled without a period")
+var ErrPolarity = errors.New("unknown polarity")
+
+type State struct {
+	Period   time.Duration `json:"period"`
+	Duty     time.Duration `json:"duty"`
+	Polarity Polarity      `json:"polarity"`
+	Enabled  bool          `json:"enabled"`
+}
+
+func (s State) String() string {
+	enabled := "disabled"
+	if s.Enabled {
+		enabled = "enabled"
+	}
+	return fmt.Sprintf("%v/%v %s %s", s.Duty, s.Period, s.Polarity, enabled)
+}
+
+// Validate checks the state against the constraints of the kernel pwm api
+func (s State) Validate() error {
+	if s.Period < 0 || s.Duty < 0 {
+		return fmt.Errorf("%w: %v/%v", ErrNegative, s.Duty, s.Period)
+	}
+	if s.Duty > s.Period {
+		return fmt.Errorf("%w: %v > %v", ErrDutyExceedsPeriod, s.Duty, s.Period)
+	}
+	if s.Polarity != PolarityNormal && s.Polarity != PolarityInversed {
+		return fmt.Errorf("%w %q", ErrPolarity, s.Polarity)
+	}
+	if s.Enabled && s.Period == 0 {
+		return ErrNoPeriod
+	}
+	return nil
+}
+
+// State reads back the current settings of the channel
+func (pwm *PWM) State() (State, error) {
+	state := State{}
+	period, err := pwm.readInt("period")
+	if err != nil {
+		return state, err
+	}
+	duty, err := pwm.readInt("duty_cycle")
+	if err != nil {
+		return state, err
+	}
+	polarity, err := pwm.read("polarity")
+	if err != nil {
+		return state, err
+	}
+	enabled, err := pwm.readInt("enable")
+	if err != nil {
+		return state, err
+	}
+	state.Period = time.Duration(period)
+	state.Duty = time.Duration(duty)
+	state.Polarity = Polarity(polarity)
+	state.Enabled = enabled == 1
+	return state, nil
+}
+
+// Apply moves the channel to the state with the fewest writes, ordered so that
+// the duty cycle never exceeds the period and the polarity only changes while disabled.
+// The state is validated first, nothing is written if it's invalid.
+func (pwm *PWM) Apply(state State) error {
+	if err := state.Validate(); err != nil {
+		return fmt.Errorf("unable to apply %s to %s: %w", state, pwm, err)
+	}
+	current, err := pwm.State()
+	if err != nil {
+		return fmt.Errorf("unable to read the state of %s: %w", pwm, err)
+	}
+
+	if state.Polarity != current.Polarity && current.Enabled {
+		if err := pwm.Disable(); err != nil {
+			return fmt.Errorf("unable to disable %s to change its polarity: %w", pwm, err)
+		}
+		current.Enabled = false
+	}
+	if state.Duty > current.Period {
+		// the period grows first, it can't be below the current duty cycle as the new duty cycle is above
+		if err := pwm.applyPeriod(state, current); err != nil {
+			return err
+		}
+		current.Period = state.Period
+		if err := pwm.applyDuty(state, current); err != nil {
+			return err
+		}
+	} else {
+		// the duty cycle fits in the current period, the new period then can't be below it
+		if err := pwm.applyDuty(state, current); err != nil {
+			return err
+		}
+		current.Duty = state.Duty
+		if err := pwm.applyPeriod(state, current); err != nil {
+			return err
+		}
+	}
+	if state.Polarity != current.Polarity {
+		if err := pwm.Polarity(state.Polarity); err != nil {
+			return fmt.Errorf("unable to set polarity of %s to %s: %w", pwm, state.Polarity, err)
+		}
+	}
+	if state.Enabled != current.Enabled {
+		if state.Enabled {
+			err = pwm.Enable()
+		} else {
+			err = pwm.Disable()
+		}
+		if err != nil {
+			return fmt.Errorf("unable to set enabled of %s to %t: %w", pwm, state.Enabled, err)
+		}
+	}
+	return nil
+}
+
+func (pwm *PWM) applyPeriod(state State, current State) error {
+	if state.Period == current.Period {
+		return nil
+	}
+	if err := pwm.Period(state.Period); err != nil {
+		return fmt.Errorf("unable to set period of %s to %v with duty cycle %v: %w", pwm, state.Period, current.Duty, err)
+	}
+	return nil
+}
+
+func (pwm *PWM) applyDuty(state State, current State) error {
+	if state.Duty == current.Duty {
+		return nil
+	}
+	if err := pwm.DutyCycle(state.Duty); err != nil {
+		return fmt.Errorf("unable to set duty cycle of %s to %v within period %v: %w", pwm, state.Duty, current.Period, err)
+	}
+	return nil
+}
+
+func (pwm *PWM) read(attr string) (string, error) {
+	name, err := pwm.path(attr)
+	if err != nil {
+		return "", err
+	}
+	data, err := fsRoot.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (pwm *PWM) readInt(attr string) (int64, error) {
+	value, err := pwm.read(attr)
+	if err != nil {
+		return 0, err
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse %s of %s: %w", attr, pwm, err)
+	}
+	return number, nil
+}
@@ -0,0 +1,228 @@
+package rc
+
+import (
+	"bbai64/gpio"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// based on the usual hobby receiver output: a 1-2ms pulse per channel every 10-25ms
+
+const PULSE_MIN_DEFAULT = 1000 * time.Microsecond
+const PULSE_CENTER_DEFAULT = 1500 * time.Microsecond
+const PULSE_MAX_DEFAULT = 2000 * time.Microsecond
+
+// pulses out of this range are glitches and are ignored
+const PULSE_VALID_MIN = 800 * time.Microsecond
+const PULSE_VALID_MAX = 2200 * time.Microsecond
+
+// SIGNAL_TIMEOUT is how long without a valid pulse it takes to consider the signal lost,
+// receivers either stop their pulses or hold the last ones on failsafe
+const SIGNAL_TIMEOUT = 100 * time.Millisecond
+
+type Mode string
+
+const (
+	MANUAL     Mode = "manual"     // the RC transmitter drives
+	WEB        Mode = "web"        // the WebSocket UI drives
+	AUTONOMOUS Mode = "autonomous" // neither does, an autopilot would
+)
+
+// ModeFromValue maps a 3 position switch channel: low is manual, middle is web and high is autonomous
+func ModeFromValue(value float64) Mode {
+	switch {
+	case value < -1.0/3:
+		return MANUAL
+	case value > 1.0/3:
+		return AUTONOMOUS
+	}
+	return WEB
+}
+
+type Calibration struct {
+	Min     time.Duration `json:"min"`
+	Center  time.Duration `json:"center"`
+	Max     time.Duration `json:"max"`
+	Reverse bool          `json:"reverse"`
+}
+
+func DefaultCalibration() Calibration {
+	return Calibration{Min: PULSE_MIN_DEFAULT, Center: PULSE_CENTER_DEFAULT, Max: PULSE_MAX_DEFAULT}
+}
+
+// Normalize maps a pulse to [-1, 1], each side of the center scaled to its endpoint
+func (c Calibration) Normalize(pulse time.Duration) float64 {
+	var value float64
+	if pulse >= c.Center {
+		value = float64(pulse-c.Center) / float64(c.Max-c.Center)
+	} else {
+		value = float64(pulse-c.Center) / float64(c.Center-c.Min)
+	}
+	value = min(max(value, -1), 1)
+	if c.Reverse {
+		return -value
+	}
+	return value
+}
+
+type Status struct {
+	Pulse    time.Duration `json:"pulse"`
+	Value    float64       `json:"value"`
+	Valid    bool          `json:"valid"`
+	Glitches uint64        `json:"glitches"`
+}
+
+// Channel measures the pulse width of one receiver channel from its edge timestamps
+type Channel struct {
+	mu          sync.Mutex
+	calibration Calibration
+	rising      time.Duration // timestamp of the rising edge of the current pulse, 0 if unknown
+	seqno       uint32
+	pulse       time.Duration
+	received    time.Duration // timestamp of the end of the last valid pulse
+	glitches    uint64
+}
+
+func NewChannel(calibration Calibration) *Channel {
+	return &Channel{calibration: calibration}
+}
+
+// Update measures a pulse on its falling edge, a missed edge drops the pulse it belongs to
+func (c *Channel) Update(event gpio.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seqno != 0 && event.Seqno != c.seqno+1 {
+		c.rising = 0
+	}
+	c.seqno = event.Seqno
+	if event.Edge == gpio.RISING {
+		c.rising = event.Timestamp
+		return
+	}
+	if c.rising == 0 {
+		return
+	}
+	width := event.Timestamp - c.rising
+	c.rising = 0
+	if width < PULSE_VALID_MIN || width > PULSE_VALID_MAX {
+		c.glitches++
+		return
+	}
+	c.pulse = width
+	c.received = event.Timestamp
+}
+
+// Value returns the normalized position at the CLOCK_MONOTONIC time now, false when the signal is lost
+func (c *Channel) Value(now time.Duration) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.received == 0 || now-c.received > SIGNAL_TIMEOUT {
+		return 0, false
+	}
+	return c.calibration.Normalize(c.pulse), true
+}
+
+func (c *Channel) Status(now time.Duration) Status {
+	value, valid := c.Value(now)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Status{Pulse: c.pulse, Value: value, Valid: valid, Glitches: c.glitches}
+}
+
+// Receiver captures the channels of a receiver wired to gpio inputs through a 5V to 3.3V level shifter
+type Receiver struct {
+	pins     []*gpio.Pin
+	channels []*Channel
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewReceiver starts measuring one channel per pin, in order.
+// The pulses are measured from the kernel timestamps of the cdev backend, see gpio.ActiveBackend.
+func NewReceiver(aliases []gpio.Alias, calibrations []Calibration) (*Receiver, error) {
+	if len(aliases) != len(calibrations) {
+		return nil, fmt.Errorf("unable to create rc receiver: %d pins for %d calibrations", len(aliases), len(calibrations))
+	}
+	if gpio.ActiveBackend() != gpio.CDEV {
+		return nil, fmt.Errorf("unable to create rc receiver: %w", gpio.ErrUserspaceTimestamps)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Receiver{cancel: cancel}
+	for i, alias := range aliases {
+		pin, err := exportInput(alias)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.pins = append(r.pins, pin)
+		channel := NewChannel(calibrations[i])
+		r.channels = append(r.channels, channel)
+		events, err := pin.Events(ctx)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			for event := range events {
+				channel.Update(event)
+			}
+		}()
+	}
+	return r, nil
+}
+
+func exportInput(alias gpio.Alias) (*gpio.Pin, error) {
+	pin, err := gpio.Export(alias)
+	if err != nil {
+		return nil, err
+	}
+	pin.SetSafeState(gpio.SafeState{Direction: gpio.IN, Edge: gpio.NONE})
+	if err := pin.SetDirection(gpio.IN); err != nil {
+		pin.Release()
+		return nil, err
+	}
+	if err := pin.SetEdge(gpio.BOTH); err != nil {
+		pin.Release()
+		return nil, err
+	}
+	return pin, nil
+}
+
+func (r *Receiver) Channel(index int) *Channel {
+	return r.channels[index]
+}
+
+// Values returns the normalized positions of all channels, false if any of them lost the signal
+func (r *Receiver) Values() ([]float64, bool) {
+	now := gpio.Now()
+	values := make([]float64, len(r.channels))
+	ok := true
+	for i, channel := range r.channels {
+		value, valid := channel.Value(now)
+		values[i] = value
+		ok = ok && valid
+	}
+	return values, ok
+}
+
+func (r *Receiver) Status() []Status {
+	now := gpio.Now()
+	status := make([]Status, len(r.channels))
+	for i, channel := range r.channels {
+		status[i] = channel.Status(now)
+	}
+	return status
+}
+
+// Close stops measuring and releases the pins
+func (r *Receiver) Close() {
+	r.cancel()
+	r.wg.Wait()
+	for _, pin := range r.pins {
+		pin.Release()
+	}
+}
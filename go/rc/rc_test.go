@@ -0,0 +1,64 @@
+package rc
+
+import (
+	"bbai64/gpio"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChannel(t *testing.T) {
+	channel := NewChannel(DefaultCalibration())
+	start := time.Second
+	pulse := func(seqno uint32, at time.Duration, width time.Duration) {
+		channel.Update(gpio.Event{Edge: gpio.RISING, Timestamp: at, Seqno: seqno})
+		channel.Update(gpio.Event{Edge: gpio.FALLING, Timestamp: at + width, Seqno: seqno + 1})
+	}
+	if _, ok := channel.Value(start); ok {
+		t.Error("expected no signal before the first pulse")
+	}
+
+	pulse(1, start, 1750*time.Microsecond)
+	if value, ok := channel.Value(start + 10*time.Millisecond); !ok || value != 0.5 {
+		t.Errorf("unexpected value %f %t", value, ok)
+	}
+
+	// a glitch and a pulse with a missed falling edge are both ignored
+	pulse(3, start+20*time.Millisecond, 100*time.Microsecond)
+	channel.Update(gpio.Event{Edge: gpio.RISING, Timestamp: start + 40*time.Millisecond, Seqno: 5})
+	channel.Update(gpio.Event{Edge: gpio.FALLING, Timestamp: start + 62*time.Millisecond, Seqno: 7})
+	if status := channel.Status(start + 70*time.Millisecond); status.Pulse != 1750*time.Microsecond || status.Glitches != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	if _, ok := channel.Value(start + 200*time.Millisecond); ok {
+		t.Error("expected the signal to be lost")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	c := Calibration{Min: 1100 * time.Microsecond, Center: 1500 * time.Microsecond, Max: 1900 * time.Microsecond, Reverse: true}
+	if value := c.Normalize(1100 * time.Microsecond); value != 1 {
+		t.Errorf("expected reversed 1, got %f", value)
+	}
+	if value := c.Normalize(2100 * time.Microsecond); value != -1 {
+		t.Errorf("expected clamped reversed -1, got %f", value)
+	}
+}
+
+func TestModeFromValue(t *testing.T) {
+	cases := map[float64]Mode{-1: MANUAL, -0.5: MANUAL, 0: WEB, 0.2: WEB, 0.9: AUTONOMOUS}
+	for value, mode := range cases {
+		if m := ModeFromValue(value); m != mode {
+			t.Errorf("expected %s for %f, got %s", mode, value, m)
+		}
+	}
+}
+
+func TestNewReceiverRequiresCdev(t *testing.T) {
+	gpio.SetBackend(gpio.SYSFS)
+	defer gpio.SetBackend("")
+	if _, err := NewReceiver([]gpio.Alias{gpio.P8_03}, []Calibration{DefaultCalibration()}); !errors.Is(err, gpio.ErrUserspaceTimestamps) {
+		t.Errorf("expected the sysfs backend to be rejected, got %v", err)
+	}
+}
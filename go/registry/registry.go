@@ -0,0 +1,128 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Resource is a piece of hardware which has to be put back into a safe state before the process exits,
+// gpio pins and pwm channels register themselves when they are exported or claimed
+type Resource interface {
+	Release() error
+}
+
+var mu sync.Mutex
+var resources = []Resource{}
+
+func Register(resource Resource) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, r := range resources {
+		if r == resource {
+			return
+		}
+	}
+	resources = append(resources, resource)
+}
+
+func Unregister(resource Resource) {
+	mu.Lock()
+	defer mu.Unlock()
+	for i, r := range resources {
+		if r == resource {
+			resources = append(resources[:i], resources[i+1:]...)
+			return
+		}
+	}
+}
+
+// Resources returns the registered resources in registration order
+func Resources() []Resource {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Resource(nil), resources...)
+}
+
+// ReleaseAll releases every registered resource, the most recent first as defer would do.
+// It keeps going when a release fails and returns all the errors.
+func ReleaseAll() error {
+	mu.Lock()
+	pending := resources
+	resources = []Resource{}
+	mu.Unlock()
+	errs := []error{}
+	for i := len(pending) - 1; i >= 0; i-- {
+		if err := pending[i].Release(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func releaseAllAndLog() {
+	if err := ReleaseAll(); err != nil {
+		log.Print("Unable to release all resources: ", err)
+	}
+}
+
+// HandleSignals releases everything and exits on SIGINT or SIGTERM,
+// for programs which don't handle the signals themselves. Call stop to uninstall the handler.
+func HandleSignals() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Print("Releasing resources on ", sig)
+			releaseAllAndLog()
+			code := 1
+			if sig, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(sig)
+			}
+			os.Exit(code)
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+// Recover releases everything if the goroutine panics, then panics again.
+// It has to be deferred directly: defer registry.Recover()
+func Recover() {
+	if r := recover(); r != nil {
+		releaseAllAndLog()
+		panic(r)
+	}
+}
+
+// Go runs f in a new goroutine which releases everything if f panics,
+// as a panic in any goroutine ends the process without running the defers of the others
+func Go(f func()) {
+	go func() {
+		defer Recover()
+		f()
+	}()
+}
+
+// Fatal releases everything, then calls log.Fatal which skips the deferred calls
+func Fatal(v ...any) {
+	releaseAllAndLog()
+	log.Fatal(v...)
+}
+
+func Fatalf(format string, v ...any) {
+	releaseAllAndLog()
+	log.Fatal(fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+)
+
+type resource struct {
+	name     string
+	err      error
+	released *[]string
+}
+
+func (r *resource) Release() error {
+	*r.released = append(*r.released, r.name)
+	return r.err
+}
+
+func TestReleaseAll(t *testing.T) {
+	released := []string{}
+	failure := errors.New("failure")
+	a := &resource{name: "a", released: &released}
+	b := &resource{name: "b", err: failure, released: &released}
+	c := &resource{name: "c", released: &released}
+	Register(a)
+	Register(b)
+	Register(b)
+	Register(c)
+	Unregister(c)
+	if n := len(Resources()); n != 2 {
+		t.Fatalf("expected 2 resources, got %d", n)
+	}
+
+	if err := ReleaseAll(); !errors.Is(err, failure) {
+		t.Errorf("expected the release failure, got %v", err)
+	}
+	if len(released) != 2 || released[0] != "b" || released[1] != "a" {
+		t.Errorf("unexpected release order %v", released)
+	}
+	if err := ReleaseAll(); err != nil || len(released) != 2 {
+		t.Errorf("expected nothing left to release, got %v %v", err, released)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	released := []string{}
+	Register(&resource{name: "a", released: &released})
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("expected the panic to go on, got %v", r)
+		}
+		if len(released) != 1 {
+			t.Errorf("expected the resource to be released, got %v", released)
+		}
+	}()
+	func() {
+		defer Recover()
+		panic("boom")
+	}()
+}
@@ -0,0 +1,251 @@
+package servo
+
+import (
+	"bbai64/pwm"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+const PWM_PERIOD = 20 * time.Millisecond
+const PULSE_MIN_DEFAULT = 1180 * time.Microsecond
+const PULSE_CENTER_DEFAULT = 1500 * time.Microsecond
+const PULSE_MAX_DEFAULT = 1820 * time.Microsecond
+
+// RATE_STEP is how often a rate limited servo moves towards its target, once per pwm period
+const RATE_STEP = PWM_PERIOD
+
+var ErrCalibration = errors.New("invalid servo calibration")
+
+// Calibration describes the pulses of one servo, it is meant to be saved per vehicle
+type Calibration struct {
+	Min      time.Duration `json:"min"`      // pulse at -1
+	Center   time.Duration `json:"center"`   // pulse at 0, before trim
+	Max      time.Duration `json:"max"`      // pulse at 1
+	Trim     time.Duration `json:"trim"`     // added to every pulse, the result is still clamped to [Min, Max]
+	Reverse  bool          `json:"reverse"`  // swaps -1 and 1
+	MaxRate  float64       `json:"maxRate"`  // in normalized units per second, e.g. 4 takes 0.5s from -1 to 1, 0 for no limit
+	Polarity pwm.Polarity  `json:"polarity"` // of the pwm channel
+}
+
+func DefaultCalibration() Calibration {
+	return Calibration{
+		Min:      PULSE_MIN_DEFAULT,
+		Center:   PULSE_CENTER_DEFAULT,
+		Max:      PULSE_MAX_DEFAULT,
+		Polarity: pwm.PolarityNormal,
+	}
+}
+
+func (c Calibration) Validate() error {
+	if c.Min <= 0 || c.Min >= c.Center || c.Center >= c.Max {
+		return fmt.Errorf("%w: expected 0 < min %v < center %v < max %v", ErrCalibration, c.Min, c.Center, c.Max)
+	}
+	if c.Max >= PWM_PERIOD {
+		return fmt.Errorf("%w: max %v does not fit in the period %v", ErrCalibration, c.Max, PWM_PERIOD)
+	}
+	if c.MaxRate < 0 {
+		return fmt.Errorf("%w: negative max rate %f", ErrCalibration, c.MaxRate)
+	}
+	if c.Polarity != pwm.PolarityNormal && c.Polarity != pwm.PolarityInversed {
+		return fmt.Errorf("%w: unknown polarity %q", ErrCalibration, c.Polarity)
+	}
+	return nil
+}
+
+// Pulse maps a normalized value in [-1, 1] to a pulse width, each side of the center scaled to its endpoint
+func (c Calibration) Pulse(value float64) time.Duration {
+	value = min(max(value, -1), 1)
+	if c.Reverse {
+		value = -value
+	}
+	pulse := c.Center
+	if value > 0 {
+		pulse += time.Duration(value * float64(c.Max-c.Center))
+	} else {
+		pulse += time.Duration(value * float64(c.Center-c.Min))
+	}
+	return min(max(pulse+c.Trim, c.Min), c.Max)
+}
+
+// LoadCalibrations reads named calibrations saved with SaveCalibrations
+func LoadCalibrations(path string) (map[string]Calibration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	calibrations := map[string]Calibration{}
+	if err := json.Unmarshal(data, &calibrations); err != nil {
+		return nil, fmt.Errorf("unable to parse servo calibrations %s: %w", path, err)
+	}
+	for name, calibration := range calibrations {
+		if err := calibration.Validate(); err != nil {
+			return nil, fmt.Errorf("unable to load servo calibration %s from %s: %w", name, path, err)
+		}
+	}
+	return calibrations, nil
+}
+
+func SaveCalibrations(path string, calibrations map[string]Calibration) error {
+	data, err := json.MarshalIndent(calibrations, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Servo drives a hobby servo or anything taking servo pulses, like an ESC
+type Servo struct {
+	mu          sync.Mutex
+	pwm         *pwm.PWM
+	calibration Calibration
+	position    float64
+	target      float64
+	pulse       time.Duration
+	lastStep    time.Time
+	stepping    bool
+}
+
+// New enables the channel with the center pulse
+func New(p *pwm.PWM, calibration Calibration) (*Servo, error) {
+	if err := calibration.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Servo{pwm: p, calibration: calibration}
+	pulse := calibration.Pulse(0)
+	err := p.Apply(pwm.State{
+		Period:   PWM_PERIOD,
+		Duty:     pulse,
+		Polarity: calibration.Polarity,
+		Enabled:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.pulse = pulse
+	return s, nil
+}
+
+func (s *Servo) Calibration() Calibration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calibration
+}
+
+// SetCalibration applies a new calibration right away, keeping the position
+func (s *Servo) SetCalibration(calibration Calibration) error {
+	if err := calibration.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if calibration.Polarity != s.calibration.Polarity {
+		state, err := s.pwm.State()
+		if err != nil {
+			return err
+		}
+		state.Polarity = calibration.Polarity
+		if err := s.pwm.Apply(state); err != nil {
+			return err
+		}
+	}
+	s.calibration = calibration
+	return s.write(calibration.Pulse(s.position))
+}
+
+// Set moves the servo to a normalized position in [-1, 1],
+// at the maximum rate of the calibration if there is one
+func (s *Servo) Set(value float64) error {
+	value = min(max(value, -1), 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.target = value
+	if s.calibration.MaxRate == 0 {
+		s.position = value
+		return s.write(s.calibration.Pulse(value))
+	}
+	if !s.stepping && s.position != value {
+		s.stepping = true
+		s.lastStep = time.Now()
+		go s.run()
+	}
+	return nil
+}
+
+// SetNow moves the servo to a position ignoring the maximum rate, e.g. to center it on a reset
+func (s *Servo) SetNow(value float64) error {
+	value = min(max(value, -1), 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.target = value
+	s.position = value
+	return s.write(s.calibration.Pulse(value))
+}
+
+// Position returns where the servo is commanded to be now, it lags the target when rate limited
+func (s *Servo) Position() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.position
+}
+
+func (s *Servo) Pulse() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pulse
+}
+
+func (s *Servo) run() {
+	ticker := time.NewTicker(RATE_STEP)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if !s.step(now) {
+			return
+		}
+	}
+}
+
+// step moves the position towards the target and tells if there is more to go
+func (s *Servo) step(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stepping {
+		return false
+	}
+	delta := s.calibration.MaxRate * now.Sub(s.lastStep).Seconds()
+	s.lastStep = now
+	if s.calibration.MaxRate == 0 || math.Abs(s.target-s.position) <= delta {
+		s.position = s.target
+	} else if s.target > s.position {
+		s.position += delta
+	} else {
+		s.position -= delta
+	}
+	s.write(s.calibration.Pulse(s.position))
+	s.stepping = s.position != s.target
+	return s.stepping
+}
+
+// write must be called with the lock held, unchanged pulses are not written
+func (s *Servo) write(pulse time.Duration) error {
+	if pulse == s.pulse {
+		return nil
+	}
+	if err := s.pwm.DutyCycle(pulse); err != nil {
+		return fmt.Errorf("unable to set servo pulse %v on %s: %w", pulse, s.pwm, err)
+	}
+	s.pulse = pulse
+	return nil
+}
+
+// Disable stops the pulses, most servos then go limp
+func (s *Servo) Disable() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stepping = false
+	return s.pwm.Disable()
+}
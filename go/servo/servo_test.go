@@ -0,0 +1,108 @@
+package servo
+
+import (
+	"bbai64/hwtest"
+	"bbai64/pwm"
+	"bbai64/sysfs"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPulse(t *testing.T) {
+	c := Calibration{Min: 1000 * time.Microsecond, Center: 1400 * time.Microsecond, Max: 2000 * time.Microsecond, Polarity: pwm.PolarityNormal}
+	cases := []struct {
+		value float64
+		pulse time.Duration
+	}{
+		{-1, 1000 * time.Microsecond},
+		{-0.5, 1200 * time.Microsecond},
+		{0, 1400 * time.Microsecond},
+		{0.5, 1700 * time.Microsecond},
+		{2, 2000 * time.Microsecond},
+	}
+	for _, test := range cases {
+		if pulse := c.Pulse(test.value); pulse != test.pulse {
+			t.Errorf("expected %v for %f, got %v", test.pulse, test.value, pulse)
+		}
+	}
+
+	c.Reverse = true
+	c.Trim = 100 * time.Microsecond
+	if pulse := c.Pulse(-1); pulse != 2000*time.Microsecond {
+		t.Errorf("expected the reversed, trimmed endpoint to be clamped, got %v", pulse)
+	}
+	if pulse := c.Pulse(0); pulse != 1500*time.Microsecond {
+		t.Errorf("expected the trimmed center, got %v", pulse)
+	}
+	if pulse := c.Pulse(1); pulse != 1100*time.Microsecond {
+		t.Errorf("expected the reversed, trimmed minimum, got %v", pulse)
+	}
+}
+
+func TestCalibrationFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calibration.json")
+	c := DefaultCalibration()
+	c.Trim = -20 * time.Microsecond
+	c.MaxRate = 4
+	if err := SaveCalibrations(path, map[string]Calibration{"steering": c}); err != nil {
+		t.Fatal(err)
+	}
+	calibrations, err := LoadCalibrations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calibrations["steering"] != c {
+		t.Errorf("unexpected calibration %+v", calibrations["steering"])
+	}
+
+	c.Center = c.Max
+	SaveCalibrations(path, map[string]Calibration{"steering": c})
+	if _, err := LoadCalibrations(path); !errors.Is(err, ErrCalibration) {
+		t.Errorf("expected an invalid calibration error, got %v", err)
+	}
+}
+
+func TestMaxRate(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddBonePWM(0, "a")
+	pwm.SetFS(tree)
+	defer pwm.SetFS(sysfs.Host)
+	p := pwm.NewPWM(pwm.Bus0, pwm.ChannelA)
+	defer p.Release()
+
+	c := DefaultCalibration()
+	c.MaxRate = 2
+	s, err := New(p, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if duty := tree.Read("/dev/bone/pwm/0/a/duty_cycle"); duty != "1500000" {
+		t.Errorf("expected the center pulse, got %s", duty)
+	}
+
+	// step by hand instead of waiting for the ticker
+	s.mu.Lock()
+	s.target = 1
+	s.stepping = true
+	start := time.Now()
+	s.lastStep = start
+	s.mu.Unlock()
+	if !s.step(start.Add(250 * time.Millisecond)) {
+		t.Error("expected the servo to keep moving")
+	}
+	if position := s.Position(); position != 0.5 {
+		t.Errorf("expected half way, got %f", position)
+	}
+	if s.step(start.Add(time.Second)) {
+		t.Error("expected the servo to reach its target")
+	}
+	if duty := tree.Read("/dev/bone/pwm/0/a/duty_cycle"); duty != "1820000" {
+		t.Errorf("expected the max pulse, got %s", duty)
+	}
+
+	if err := s.SetNow(0); err != nil || s.Pulse() != PULSE_CENTER_DEFAULT {
+		t.Errorf("expected the servo to be centered at once, got %v: %v", s.Pulse(), err)
+	}
+}
@@ -0,0 +1,60 @@
+package sysfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// File is an open attribute file, Fd is needed to poll() for notifications
+type File interface {
+	io.ReadWriteSeeker
+	io.Closer
+	Fd() uintptr
+}
+
+// FS gives access to the attribute files of /sys and /dev under a root directory,
+// so the hardware can be replaced by a fake tree in tests.
+// Names are absolute paths as seen on the board, e.g. "/sys/class/gpio/export".
+type FS interface {
+	Root() string
+	Stat(name string) (fs.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+	OpenFile(name string, flag int) (File, error)
+}
+
+// Dir is the FS of the operating system rooted at a directory
+type Dir string
+
+// Host is the real filesystem of the board
+const Host Dir = "/"
+
+func (d Dir) Root() string {
+	return string(d)
+}
+
+func (d Dir) Path(name string) string {
+	return filepath.Join(string(d), name)
+}
+
+func (d Dir) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(d.Path(name))
+}
+
+func (d Dir) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(d.Path(name))
+}
+
+func (d Dir) WriteFile(name string, data []byte) error {
+	return os.WriteFile(d.Path(name), data, 0666)
+}
+
+func (d Dir) OpenFile(name string, flag int) (File, error) {
+	f, err := os.OpenFile(d.Path(name), flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
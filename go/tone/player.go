@@ -0,0 +1,214 @@
+package tone
+
+import (
+	"bbai64/pwm"
+	"container/heap"
+	"log"
+	"sync"
+	"time"
+)
+
+type Priority int
+
+const (
+	PRIORITY_CHIME  Priority = 0 // connection events and the like
+	PRIORITY_NOTICE Priority = 1
+	PRIORITY_ALARM  Priority = 2 // low battery, errors
+)
+
+// QUEUE_SIZE_MAX bounds the pending melodies, the lowest priority ones are dropped beyond it
+const QUEUE_SIZE_MAX = 16
+
+type entry struct {
+	melody   Melody
+	priority Priority
+	order    uint64
+}
+
+// queue is a heap of the pending melodies, highest priority first then oldest first
+type queue []*entry
+
+func (q queue) Len() int { return len(q) }
+func (q queue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].order < q[j].order
+}
+func (q queue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *queue) Push(x any)   { *q = append(*q, x.(*entry)) }
+func (q *queue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// Player plays melodies on a piezo buzzer in the background.
+// A melody of a higher priority interrupts the one playing, which is dropped.
+type Player struct {
+	mu      sync.Mutex
+	pwm     *pwm.PWM
+	queue   queue
+	order   uint64
+	playing *entry
+	wake    chan struct{}
+	done    chan struct{}
+	closed  bool
+}
+
+func NewPlayer(p *pwm.PWM) *Player {
+	player := &Player{
+		pwm:  p,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go player.run()
+	return player
+}
+
+// Play queues a melody and returns at once
+func (p *Player) Play(melody Melody, priority Priority) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.order++
+	heap.Push(&p.queue, &entry{melody: melody, priority: priority, order: p.order})
+	if p.queue.Len() > QUEUE_SIZE_MAX {
+		p.dropLowest()
+	}
+	p.signal()
+}
+
+func (p *Player) dropLowest() {
+	lowest := 0
+	for i := range p.queue {
+		if p.queue.Less(lowest, i) {
+			lowest = i
+		}
+	}
+	heap.Remove(&p.queue, lowest)
+}
+
+// Stop silences the buzzer and drops the pending melodies
+func (p *Player) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queue = nil
+	p.playing = nil
+	p.signal()
+}
+
+// Playing tells if a melody is playing or pending
+func (p *Player) Playing() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.playing != nil || p.queue.Len() > 0
+}
+
+// Close stops the playback and disables the channel
+func (p *Player) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.queue = nil
+	p.playing = nil
+	p.signal()
+	p.mu.Unlock()
+	<-p.done
+	return p.pwm.Disable()
+}
+
+func (p *Player) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next picks the melody to play, the one playing unless a higher priority one is pending
+func (p *Player) next() (*entry, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, false
+	}
+	if p.queue.Len() > 0 && (p.playing == nil || p.queue[0].priority > p.playing.priority) {
+		p.playing = heap.Pop(&p.queue).(*entry)
+	}
+	return p.playing, true
+}
+
+func (p *Player) finished(e *entry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.playing == e {
+		p.playing = nil
+	}
+}
+
+func (p *Player) run() {
+	defer close(p.done)
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	var current *entry
+	var index int
+	var deadline time.Time // end of the note being played
+	for {
+		e, ok := p.next()
+		if !ok {
+			p.silence()
+			return
+		}
+		if e != current {
+			current, index, deadline = e, 0, time.Time{}
+		}
+		if current == nil {
+			p.silence()
+			<-p.wake
+			continue
+		}
+		if !time.Now().Before(deadline) {
+			if index >= len(current.melody.Notes) {
+				p.finished(current)
+				current = nil
+				continue
+			}
+			note := current.melody.Notes[index]
+			index++
+			p.sound(note.Frequency)
+			deadline = time.Now().Add(note.Duration)
+		}
+		timer.Reset(time.Until(deadline))
+		select {
+		case <-timer.C:
+		case <-p.wake:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		}
+	}
+}
+
+func (p *Player) sound(frequency float64) {
+	if frequency < FREQUENCY_MIN || frequency > FREQUENCY_MAX {
+		p.silence()
+		return
+	}
+	period := time.Duration(float64(time.Second) / frequency)
+	if err := p.pwm.Apply(pwm.State{
+		Period:   period,
+		Duty:     period / 2,
+		Polarity: pwm.PolarityNormal,
+		Enabled:  true,
+	}); err != nil {
+		log.Print("Could not play tone: ", err)
+	}
+}
+
+func (p *Player) silence() {
+	if err := p.pwm.Disable(); err != nil {
+		log.Print("Could not silence tone: ", err)
+	}
+}
@@ -0,0 +1,157 @@
+package tone
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A4 is the pitch standard the notes are tuned to, in Hz
+const A4 = 440.0
+
+// the range of human hearing, notes outside of it are played as rests.
+// Piezo buzzers are loud in the 2-4kHz range and barely audible below 500Hz.
+const FREQUENCY_MIN = 20.0
+const FREQUENCY_MAX = 20000.0
+
+// Note is a tone of a frequency in Hz for a duration, a frequency of 0 is a rest
+type Note struct {
+	Frequency float64       `json:"frequency"`
+	Duration  time.Duration `json:"duration"`
+}
+
+type Melody struct {
+	Name  string `json:"name"`
+	Notes []Note `json:"notes"`
+}
+
+func (m Melody) Duration() time.Duration {
+	var duration time.Duration
+	for _, note := range m.Notes {
+		duration += note.Duration
+	}
+	return duration
+}
+
+var semitones = map[string]int{
+	"c": -9, "c#": -8, "d": -7, "d#": -6, "e": -5, "f": -4,
+	"f#": -3, "g": -2, "g#": -1, "a": 0, "a#": 1, "b": 2, "h": 2,
+}
+
+// Frequency returns the frequency of a note like "a", "c#" or "h" in an octave, "a" 4 being A4
+func Frequency(name string, octave int) (float64, error) {
+	semitone, ok := semitones[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown note %q", name)
+	}
+	return A4 * math.Pow(2, float64(semitone+12*(octave-4))/12), nil
+}
+
+// Tone is a single note melody, for beeps
+func Tone(frequency float64, duration time.Duration) Melody {
+	return Melody{Notes: []Note{{Frequency: frequency, Duration: duration}}}
+}
+
+// ParseRTTTL parses a Ring Tone Text Transfer Language melody like
+// "beep:d=8,o=6,b=140:c,p,c". Defaults are d=4, o=6 and b=63 as in the spec.
+func ParseRTTTL(s string) (Melody, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 {
+		return Melody{}, fmt.Errorf("invalid rtttl %q: expected name:defaults:notes", s)
+	}
+	melody := Melody{Name: strings.TrimSpace(parts[0])}
+	duration, octave, bpm := 4, 6, 63
+	for _, setting := range strings.Split(parts[1], ",") {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(setting, "=")
+		number, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || number <= 0 {
+			return Melody{}, fmt.Errorf("invalid rtttl default %q", setting)
+		}
+		switch strings.TrimSpace(strings.ToLower(key)) {
+		case "d":
+			duration = number
+		case "o":
+			octave = number
+		case "b":
+			bpm = number
+		default:
+			return Melody{}, fmt.Errorf("unknown rtttl default %q", setting)
+		}
+	}
+	// the beat is a quarter note
+	whole := 4 * time.Minute / time.Duration(bpm)
+	for _, token := range strings.Split(parts[2], ",") {
+		token = strings.TrimSpace(strings.ToLower(token))
+		if token == "" {
+			continue
+		}
+		note, err := parseRTTTLNote(token, duration, octave, whole)
+		if err != nil {
+			return Melody{}, err
+		}
+		melody.Notes = append(melody.Notes, note)
+	}
+	return melody, nil
+}
+
+// parseRTTTLNote parses [duration]note[#][.][octave][.]
+func parseRTTTLNote(token string, duration int, octave int, whole time.Duration) (Note, error) {
+	rest := token
+	digits := len(rest) - len(strings.TrimLeft(rest, "0123456789"))
+	if digits > 0 {
+		duration, _ = strconv.Atoi(rest[:digits])
+		rest = rest[digits:]
+	}
+	if rest == "" || duration <= 0 {
+		return Note{}, fmt.Errorf("invalid rtttl note %q", token)
+	}
+	name := rest[:1]
+	rest = rest[1:]
+	if strings.HasPrefix(rest, "#") {
+		name += "#"
+		rest = rest[1:]
+	}
+	dotted := false
+	if strings.HasPrefix(rest, ".") {
+		dotted = true
+		rest = rest[1:]
+	}
+	if rest != "" && rest[0] >= '0' && rest[0] <= '9' {
+		octave = int(rest[0] - '0')
+		rest = rest[1:]
+	}
+	if strings.HasPrefix(rest, ".") {
+		dotted = true
+		rest = rest[1:]
+	}
+	if rest != "" {
+		return Note{}, fmt.Errorf("invalid rtttl note %q", token)
+	}
+	length := whole / time.Duration(duration)
+	if dotted {
+		length += length / 2
+	}
+	if name == "p" {
+		return Note{Duration: length}, nil
+	}
+	frequency, err := Frequency(name, octave)
+	if err != nil {
+		return Note{}, fmt.Errorf("invalid rtttl note %q: %w", token, err)
+	}
+	return Note{Frequency: frequency, Duration: length}, nil
+}
+
+// MustParseRTTTL is ParseRTTTL for melodies known at compile time
+func MustParseRTTTL(s string) Melody {
+	melody, err := ParseRTTTL(s)
+	if err != nil {
+		panic(err)
+	}
+	return melody
+}
@@ -0,0 +1,92 @@
+package tone
+
+import (
+	"bbai64/hwtest"
+	"bbai64/pwm"
+	"bbai64/sysfs"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFrequency(t *testing.T) {
+	cases := []struct {
+		name      string
+		octave    int
+		frequency float64
+	}{
+		{"a", 4, 440},
+		{"a", 5, 880},
+		{"c", 4, 261.63},
+		{"h", 3, 246.94},
+	}
+	for _, test := range cases {
+		frequency, err := Frequency(test.name, test.octave)
+		if err != nil || math.Abs(frequency-test.frequency) > 0.01 {
+			t.Errorf("expected %f for %s%d, got %f: %v", test.frequency, test.name, test.octave, frequency, err)
+		}
+	}
+}
+
+func TestParseRTTTL(t *testing.T) {
+	melody, err := ParseRTTTL("test:d=4,o=5,b=120:8a,p,c#.6,2g4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Note{
+		{Frequency: 880, Duration: 250 * time.Millisecond},
+		{Frequency: 0, Duration: 500 * time.Millisecond},
+		{Frequency: 1108.73, Duration: 750 * time.Millisecond},
+		{Frequency: 392, Duration: time.Second},
+	}
+	if melody.Name != "test" || len(melody.Notes) != len(expected) {
+		t.Fatalf("unexpected melody %+v", melody)
+	}
+	for i, note := range melody.Notes {
+		if math.Abs(note.Frequency-expected[i].Frequency) > 0.01 || note.Duration != expected[i].Duration {
+			t.Errorf("expected note %d to be %+v, got %+v", i, expected[i], note)
+		}
+	}
+	for _, invalid := range []string{"no notes", "x:d=0:a", "x:d=4:q", "x:z=1:a", "x::4a#x"} {
+		if _, err := ParseRTTTL(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestPlayerPreemption(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddBonePWM(2, "a")
+	pwm.SetFS(tree)
+	defer pwm.SetFS(sysfs.Host)
+	channel := pwm.NewPWM(pwm.Bus2, pwm.ChannelA)
+	defer channel.Release()
+
+	player := NewPlayer(channel)
+	defer player.Close()
+	player.Play(Tone(1000, time.Second), PRIORITY_CHIME)
+	time.Sleep(20 * time.Millisecond)
+	player.Play(Tone(2000, 30*time.Millisecond), PRIORITY_ALARM)
+	player.Play(Tone(500, 30*time.Millisecond), PRIORITY_CHIME)
+
+	deadline := time.Now().Add(time.Second)
+	for player.Playing() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if player.Playing() {
+		t.Fatal("expected the chime to be dropped once preempted")
+	}
+	periods := tree.WritesTo("/dev/bone/pwm/2/a/period")
+	expected := []string{"1000000", "500000", "2000000"}
+	if len(periods) != len(expected) {
+		t.Fatalf("expected 1kHz, 2kHz then 500Hz, got periods %v", periods)
+	}
+	for i := range expected {
+		if periods[i] != expected[i] {
+			t.Errorf("expected 1kHz, 2kHz then 500Hz, got periods %v", periods)
+		}
+	}
+	if tree.Read("/dev/bone/pwm/2/a/enable") != "0" {
+		t.Error("expected the buzzer to be silent")
+	}
+}
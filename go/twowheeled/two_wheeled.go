@@ -2,6 +2,7 @@ package twowheeled
 
 import (
 	"bbai64/pwm"
+	"bbai64/registry"
 	"log"
 	"time"
 )
@@ -12,77 +13,43 @@ type State struct {
 
 const PWM_PERIOD = 1 * time.Millisecond
 const PWM_DUTY_CYCLE_MAX = 400000 * time.Nanosecond // cap to 40% of max power
+const WHEELS_RAMP_TIME = 200 * time.Millisecond     // spares the gears from sudden torque
 
 var wheelLeftForward = pwm.NewPWM(pwm.Bus0, pwm.ChannelA)
 var wheelLeftBackward = pwm.NewPWM(pwm.Bus0, pwm.ChannelB)
 var wheelRightForward = pwm.NewPWM(pwm.Bus1, pwm.ChannelA)
 var wheelRightBackward = pwm.NewPWM(pwm.Bus1, pwm.ChannelB)
 
-var leftSpeedPrev float64
-var rightSpeedPrev float64
+var wheels = pwm.NewGroup(WHEELS_RAMP_TIME, wheelLeftForward, wheelLeftBackward, wheelRightForward, wheelRightBackward)
 
 func Initialize() {
 	initWheels()
 }
 
 func Reset() {
-	wheelLeftForward.DutyCycle(0)
-	wheelLeftBackward.DutyCycle(0)
-	wheelRightForward.DutyCycle(0)
-	wheelRightBackward.DutyCycle(0)
+	if err := wheels.Stop(); err != nil {
+		log.Print(err)
+	}
 }
 
 func initWheels() {
-	if err := wheelLeftForward.Period(PWM_PERIOD); err != nil {
-		log.Fatal("Could not set Left Wheel Forward pwm period")
-	}
-	if err := wheelLeftForward.Polarity(pwm.PolarityInversed); err != nil {
-		log.Fatal("Could not set Left Wheel Forward pwm polarity")
-	}
-	if err := wheelLeftForward.Enable(); err != nil {
-		log.Fatal("Could not enable Left Wheel Forward pwm")
-	}
-	if err := wheelLeftForward.DutyCycle(0); err != nil {
-		log.Fatal("Could not set Left Wheel Forward pwm duty cycle")
-	}
-
-	if err := wheelLeftBackward.Period(PWM_PERIOD); err != nil {
-		log.Fatal("Could not set Left Wheel Backward pwm period")
-	}
-	if err := wheelLeftBackward.Polarity(pwm.PolarityInversed); err != nil {
-		log.Fatal("Could not set Left Wheel Backward pwm polarity")
-	}
-	if err := wheelLeftBackward.Enable(); err != nil {
-		log.Fatal("Could not enable Left Wheel Backward pwm")
+	state := pwm.State{
+		Period:   PWM_PERIOD,
+		Duty:     0,
+		Polarity: pwm.PolarityInversed,
+		Enabled:  true,
 	}
-	if err := wheelLeftBackward.DutyCycle(0); err != nil {
-		log.Fatal("Could not set Left Wheel Backward pwm duty cycle")
+	if err := wheelLeftForward.Apply(state); err != nil {
+		registry.Fatal("Could not initialize Left Wheel Forward pwm: ", err)
 	}
-
-	if err := wheelRightForward.Period(PWM_PERIOD); err != nil {
-		log.Fatal("Could not set Right Wheel Forward pwm period")
-	}
-	if err := wheelRightForward.Polarity(pwm.PolarityInversed); err != nil {
-		log.Fatal("Could not set Right Wheel Forward pwm polarity")
-	}
-	if err := wheelRightForward.Enable(); err != nil {
-		log.Fatal("Could not enable Right Wheel Forward pwm")
-	}
-	if err := wheelRightForward.DutyCycle(0); err != nil {
-		log.Fatal("Could not set Right Wheel Forward pwm duty cycle")
+	if err := wheelLeftBackward.Apply(state); err != nil {
+		registry.Fatal("Could not initialize Left Wheel Backward pwm: ", err)
 	}
-
-	if err := wheelRightBackward.Period(PWM_PERIOD); err != nil {
-		log.Fatal("Could not set Right Wheel Backward pwm period")
-	}
-	if err := wheelRightBackward.Polarity(pwm.PolarityInversed); err != nil {
-		log.Fatal("Could not set Right Wheel Backward pwm polarity")
+	if err := wheelRightForward.Apply(state); err != nil {
+		registry.Fatal("Could not initialize Right Wheel Forward pwm: ", err)
 	}
-	if err := wheelRightBackward.Enable(); err != nil {
-		log.Fatal("Could not enable Right Wheel Backward pwm")
-	}
-	if err := wheelRightBackward.DutyCycle(0); err != nil {
-		log.Fatal("Could not set Right Wheel Backward pwm duty cycle")
+	if err := wheelRightBackward.Apply(state); err != nil {
+		registry.Fatal("Could not initialize Right Wheel Backward pwm: ", err)
 	}
 }
 
@@ -100,25 +67,17 @@ func setWheelsValues(values []float64) {
 	leftSpeed := min(max(steering+throttle, -1), 1)
 	rightSpeed := min(max(-steering+throttle, -1), 1)
 
-	if leftSpeedPrev != leftSpeed {
-		leftSpeedPrev = leftSpeed
-		if leftSpeed >= 0 {
-			wheelLeftBackward.DutyCycle(0)
-			wheelLeftForward.DutyCycle(time.Duration(leftSpeed * float64(PWM_DUTY_CYCLE_MAX)))
-		} else {
-			wheelLeftForward.DutyCycle(0)
-			wheelLeftBackward.DutyCycle(time.Duration(-leftSpeed * float64(PWM_DUTY_CYCLE_MAX)))
-		}
+	leftForward, leftBackward := wheelDuties(leftSpeed)
+	rightForward, rightBackward := wheelDuties(rightSpeed)
+	if err := wheels.Set(leftForward, leftBackward, rightForward, rightBackward); err != nil {
+		log.Print(err)
 	}
+}
 
-	if rightSpeedPrev != rightSpeed {
-		rightSpeedPrev = rightSpeed
-		if rightSpeed >= 0 {
-			wheelRightBackward.DutyCycle(0)
-			wheelRightForward.DutyCycle(time.Duration(rightSpeed * float64(PWM_DUTY_CYCLE_MAX)))
-		} else {
-			wheelRightForward.DutyCycle(0)
-			wheelRightBackward.DutyCycle(time.Duration(-rightSpeed * float64(PWM_DUTY_CYCLE_MAX)))
-		}
+// wheelDuties converts a speed in [-1, 1] to the duty cycles of the forward and backward channels of a wheel
+func wheelDuties(speed float64) (forward time.Duration, backward time.Duration) {
+	if speed >= 0 {
+		return time.Duration(speed * float64(PWM_DUTY_CYCLE_MAX)), 0
 	}
+	return 0, time.Duration(-speed * float64(PWM_DUTY_CYCLE_MAX))
 }
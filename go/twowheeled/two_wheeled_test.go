@@ -0,0 +1,53 @@
+package twowheeled
+
+import (
+	"bbai64/hwtest"
+	"bbai64/pwm"
+	"bbai64/sysfs"
+	"testing"
+)
+
+func TestTwoWheeledWheels(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	for bus := 0; bus < 2; bus++ {
+		tree.AddBonePWM(bus, "a")
+		tree.AddBonePWM(bus, "b")
+	}
+	pwm.SetFS(tree)
+	defer pwm.SetFS(sysfs.Host)
+
+	Initialize()
+	wheels.SetRamp(0)
+	defer wheels.SetRamp(WHEELS_RAMP_TIME)
+	for _, write := range tree.Writes() {
+		if write.Err != nil {
+			t.Errorf("unexpected rejected write %+v", write)
+		}
+	}
+
+	UpdateWithState(&State{Inputs: []float64{0.5, 0.5}})
+	expected := map[string]string{
+		"/dev/bone/pwm/0/a/duty_cycle": "400000",
+		"/dev/bone/pwm/0/b/duty_cycle": "0",
+		"/dev/bone/pwm/1/a/duty_cycle": "0",
+		"/dev/bone/pwm/1/b/duty_cycle": "0",
+	}
+	for name, duty := range expected {
+		if value := tree.Read(name); value != duty {
+			t.Errorf("unexpected %s %s, expected %s", name, value, duty)
+		}
+	}
+
+	UpdateWithState(&State{Inputs: []float64{0, -0.5}})
+	expected = map[string]string{
+		"/dev/bone/pwm/0/a/duty_cycle": "0",
+		"/dev/bone/pwm/0/b/duty_cycle": "200000",
+		"/dev/bone/pwm/1/a/duty_cycle": "0",
+		"/dev/bone/pwm/1/b/duty_cycle": "200000",
+	}
+	for name, duty := range expected {
+		if value := tree.Read(name); value != duty {
+			t.Errorf("unexpected %s %s, expected %s", name, value, duty)
+		}
+	}
+}
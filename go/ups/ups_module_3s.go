@@ -14,36 +14,57 @@ const LIION_CELL_VOLTAGE_MIN float64 = 3.5
 
 // Negative ShuntVoltage and Current means the battery is discharging
 type UpsModuleStatus struct {
-	BusVoltage     float64 `json:"busVoltage"`
-	ShuntVoltage   float64 `json:"shuntVoltage"`
-	BatteryVoltage float64 `json:"batteryVoltage"`
-	CellVoltage    float64 `json:"cellVoltage"`
-	Current        float64 `json:"current"`
-	Power          float64 `json:"power"`
-	ChargePercents float64 `json:"chargePercents"`
+	BusVoltage     float64           `json:"busVoltage"`
+	ShuntVoltage   float64           `json:"shuntVoltage"`
+	BatteryVoltage float64           `json:"batteryVoltage"`
+	CellVoltage    float64           `json:"cellVoltage"`
+	Current        float64           `json:"current"`
+	Power          float64           `json:"power"`
+	ChargePercents float64           `json:"chargePercents"`
+	Sensor         *i2c.DeviceStatus `json:"sensor,omitempty"` // transfer counters of the ina219 on a shared bus
 }
 
 type UpsModule3S struct {
 	mu        sync.RWMutex
 	busNumber i2c.BusNumber
+	device    i2c.Device
 	status    UpsModuleStatus
 	stop      chan bool
+	// OnRefresh is called by Run after every refresh with the status and the read error, if any.
+	// Set it before Run, it must not call Stop.
+	OnRefresh func(status UpsModuleStatus, err error)
 }
 
 func NewUpsModule3S(busNumber i2c.BusNumber) *UpsModule3S {
 	return &UpsModule3S{
 		busNumber: busNumber,
+		stop:      make(chan bool),
 	}
 }
 
+// NewUpsModule3SWithDevice uses the given ina219 device instead of opening the bus,
+// the status has its transfer counters if it is a device of an i2c.Shared bus
+func NewUpsModule3SWithDevice(device i2c.Device) *UpsModule3S {
+	return &UpsModule3S{
+		device: device,
+		stop:   make(chan bool),
+	}
+}
+
+// Run refreshes the status until Stop is called
 func (u *UpsModule3S) Run(refreshPeriod time.Duration) {
-	bus, err := i2c.Open(u.busNumber)
-	if err != nil {
-		log.Fatal("Could not open i2c bus ", u.busNumber)
+	device := u.device
+	if device == nil {
+		bus, err := i2c.OpenShared(u.busNumber)
+		if err != nil {
+			log.Fatal("Could not open i2c bus ", u.busNumber)
+		}
+		defer bus.Close()
+		device = bus.Device(ina219.ADDRESS_DEFAULT)
 	}
-	defer bus.Close()
+	shared, _ := device.(*i2c.SharedDevice)
 
-	ina219 := ina219.New(bus, ina219.ADDRESS_DEFAULT)
+	ina219 := ina219.New(device)
 	if err := ina219.SetCalibration32Volts2Amps(); err != nil {
 		log.Fatal("Could not initialize ina219: ", err)
 	}
@@ -54,6 +75,7 @@ func (u *UpsModule3S) Run(refreshPeriod time.Duration) {
 	var current float64
 	var power float64
 	var chargePercents float64
+	var err error
 	ticker := time.NewTicker(refreshPeriod)
 	defer ticker.Stop()
 	for {
@@ -93,9 +115,18 @@ func (u *UpsModule3S) Run(refreshPeriod time.Duration) {
 		u.mu.Unlock()
 
 	skip:
+		if shared != nil {
+			status := shared.Status()
+			u.mu.Lock()
+			u.status.Sensor = &status
+			u.mu.Unlock()
+		}
+		if u.OnRefresh != nil {
+			u.OnRefresh(u.Status(), err)
+		}
 		select {
 		case <-u.stop:
-			break
+			return
 		case <-ticker.C:
 		}
 	}
@@ -0,0 +1,111 @@
+package ups
+
+import (
+	"bbai64/hwtest"
+	"bbai64/i2c"
+	"bbai64/ina219"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func waitForStatus(u *UpsModule3S, busVoltage float64) (UpsModuleStatus, bool) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if status := u.Status(); math.Abs(status.BusVoltage-busVoltage) < 1e-6 {
+			return status, true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return u.Status(), false
+}
+
+func TestUpsModule3S(t *testing.T) {
+	bus := hwtest.NewI2CBus()
+	model := hwtest.NewINA219()
+	bus.Attach(ina219.ADDRESS_DEFAULT, model)
+	// discharging at 0.5A
+	model.SetVoltages(-0.05, 11)
+
+	shared := i2c.NewShared(bus)
+	u := NewUpsModule3SWithDevice(shared.Device(ina219.ADDRESS_DEFAULT))
+	done := make(chan struct{})
+	go func() {
+		u.Run(5 * time.Millisecond)
+		close(done)
+	}()
+
+	status, ok := waitForStatus(u, 11)
+	if !ok {
+		t.Fatalf("status was not refreshed: %+v", status)
+	}
+	// the voltage drops across the shunt and the internal resistance of the cells are added back
+	if math.Abs(status.BatteryVoltage-11.125) > 1e-6 || math.Abs(status.CellVoltage-11.125/3) > 1e-6 {
+		t.Errorf("unexpected battery voltage %+v", status)
+	}
+	if math.Abs(status.Current+0.5) > 1e-6 || math.Abs(status.ChargePercents-34.722222) > 1e-3 {
+		t.Errorf("unexpected current or charge %+v", status)
+	}
+
+	// the last status is kept while the reads fail
+	bus.Fail(ina219.ADDRESS_DEFAULT, hwtest.ErrTimeout, -1)
+	model.SetVoltages(0.1, 12.6)
+	time.Sleep(20 * time.Millisecond)
+	if status := u.Status(); status.BusVoltage != 11 {
+		t.Errorf("unexpected status refreshed during faults %+v", status)
+	}
+	bus.Fail(ina219.ADDRESS_DEFAULT, nil, 0)
+	status, ok = waitForStatus(u, 12.6)
+	if !ok || status.ChargePercents != 100 {
+		t.Errorf("unexpected status after faults %+v", status)
+	}
+	if status.Sensor == nil || status.Sensor.Errors == 0 || status.Sensor.LastError == "" {
+		t.Errorf("expected the timeouts to be counted, got %+v", status.Sensor)
+	}
+
+	u.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after Stop")
+	}
+}
+
+// testdata/ina219.trace is a recording with a timeout in the second refresh
+func TestUpsModule3SReplay(t *testing.T) {
+	replay, err := i2c.OpenReplay("testdata/ina219.trace", ina219.ADDRESS_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := NewUpsModule3SWithDevice(i2c.NewDevice(replay, ina219.ADDRESS_DEFAULT))
+	refreshes := make(chan error, 3)
+	u.OnRefresh = func(status UpsModuleStatus, err error) {
+		// the refreshes after the end of the recording are dropped
+		select {
+		case refreshes <- err:
+		default:
+		}
+	}
+	go u.Run(time.Millisecond)
+	defer u.Stop()
+
+	for i, expected := range []error{nil, hwtest.ErrTimeout, nil} {
+		select {
+		case err := <-refreshes:
+			if !errors.Is(err, expected) {
+				t.Errorf("unexpected error %v in refresh %d", err, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("refresh %d did not happen", i)
+		}
+	}
+	status := u.Status()
+	if replay.Remaining() != 0 {
+		t.Fatalf("recording was not replayed: %+v", status)
+	}
+	if math.Abs(status.ShuntVoltage+0.06) > 1e-6 || math.Abs(status.Current+0.6) > 1e-6 ||
+		math.Abs(status.Power-6.54) > 1e-6 || math.Abs(status.BatteryVoltage-11.05) > 1e-6 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
@@ -1,66 +1,84 @@
 package vehicle
 
 import (
+	"bbai64/esc"
 	"bbai64/pwm"
+	"bbai64/registry"
+	"bbai64/servo"
+	"errors"
+	"io/fs"
 	"log"
-	"time"
 )
 
 type State struct {
 	Inputs []float64 `json:"inputs"`
 }
 
-const PWM_PERIOD = 20 * time.Millisecond
-const PWM_DUTY_CYCLE_MIDDLE = 1500000 * time.Nanosecond
-const SERVO_PWM_DUTY_CYCLE_RANGE = 320000 * time.Nanosecond
+// CALIBRATION_FILE holds the "steering" and "throttle" servo calibrations, the defaults are used without it
+const CALIBRATION_FILE = "vehicle_calibration.json"
 
-var servoSteering = pwm.NewPWM(pwm.Bus0, pwm.ChannelA)
-var servoThrottle = pwm.NewPWM(pwm.Bus0, pwm.ChannelB)
-
-var steeringPrev float64
-var throttlePrev float64
+var pwmSteering = pwm.NewPWM(pwm.Bus0, pwm.ChannelA)
+var pwmThrottle = pwm.NewPWM(pwm.Bus0, pwm.ChannelB)
+var servoSteering *servo.Servo
+var escThrottle *esc.ESC
+var escConfig = esc.DefaultConfig()
 
 func Initialize() {
 	initServos()
 }
 
 func Reset() {
-	servoSteering.DutyCycle(PWM_DUTY_CYCLE_MIDDLE)
-	servoThrottle.DutyCycle(PWM_DUTY_CYCLE_MIDDLE)
+	servoSteering.SetNow(0)
+	escThrottle.Neutral()
 }
 
-func initServos() {
-	if err := servoSteering.Period(PWM_PERIOD); err != nil {
-		log.Fatal("Could not set Steering pwm period")
-	}
-	if err := servoSteering.DutyCycle(0); err != nil {
-		log.Fatal("Could not set Steering pwm duty cycle")
+func DefaultCalibrations() map[string]servo.Calibration {
+	calibration := servo.DefaultCalibration()
+	calibration.Polarity = pwm.PolarityInversed
+	return map[string]servo.Calibration{
+		"steering": calibration,
+		"throttle": calibration,
 	}
-	if err := servoSteering.Polarity(pwm.PolarityInversed); err != nil {
-		log.Fatal("Could not set Steering pwm polarity")
+}
+
+func loadCalibrations() map[string]servo.Calibration {
+	calibrations := DefaultCalibrations()
+	saved, err := servo.LoadCalibrations(CALIBRATION_FILE)
+	if errors.Is(err, fs.ErrNotExist) {
+		return calibrations
 	}
-	if err := servoSteering.Enable(); err != nil {
-		log.Fatal("Could not enable Steering pwm")
+	if err != nil {
+		registry.Fatal("Could not load servo calibrations: ", err)
 	}
-	if err := servoSteering.DutyCycle(PWM_DUTY_CYCLE_MIDDLE); err != nil {
-		log.Fatal("Could not set Steering pwm duty cycle")
+	for name, calibration := range saved {
+		calibrations[name] = calibration
 	}
+	return calibrations
+}
 
-	if err := servoThrottle.Period(PWM_PERIOD); err != nil {
-		log.Fatal("Could not set Throttle pwm period")
-	}
-	if err := servoThrottle.DutyCycle(0); err != nil {
-		log.Fatal("Could not set Throttle pwm duty cycle")
+func initServos() {
+	calibrations := loadCalibrations()
+	var err error
+	if servoSteering, err = servo.New(pwmSteering, calibrations["steering"]); err != nil {
+		registry.Fatal("Could not initialize Steering servo: ", err)
 	}
-	if err := servoThrottle.Polarity(pwm.PolarityInversed); err != nil {
-		log.Fatal("Could not set Throttle pwm polarity")
+	if escThrottle, err = esc.New(pwmThrottle, calibrations["throttle"], escConfig); err != nil {
+		registry.Fatal("Could not initialize Throttle esc: ", err)
 	}
-	if err := servoThrottle.Enable(); err != nil {
-		log.Fatal("Could not enable Throttle pwm")
+}
+
+// SetCalibrations applies the calibrations and saves them to CALIBRATION_FILE
+func SetCalibrations(steering servo.Calibration, throttle servo.Calibration) error {
+	if err := servoSteering.SetCalibration(steering); err != nil {
+		return err
 	}
-	if err := servoThrottle.DutyCycle(PWM_DUTY_CYCLE_MIDDLE); err != nil {
-		log.Fatal("Could not set Throttle pwm duty cycle")
+	if err := escThrottle.SetCalibration(throttle); err != nil {
+		return err
 	}
+	return servo.SaveCalibrations(CALIBRATION_FILE, map[string]servo.Calibration{
+		"steering": steering,
+		"throttle": throttle,
+	})
 }
 
 func UpdateWithState(status *State) {
@@ -72,14 +90,6 @@ func setServoValues(values []float64) {
 		log.Print("Servo values are invalid")
 		return
 	}
-	steering := min(max(values[0], -1), 1)
-	if steeringPrev != steering {
-		steeringPrev = steering
-		servoSteering.DutyCycle(PWM_DUTY_CYCLE_MIDDLE + time.Duration(steering*float64(SERVO_PWM_DUTY_CYCLE_RANGE)))
-	}
-	throttle := min(max(values[1], -1), 1)
-	if throttlePrev != throttle {
-		throttlePrev = throttle
-		servoThrottle.DutyCycle(PWM_DUTY_CYCLE_MIDDLE + time.Duration(throttle*float64(SERVO_PWM_DUTY_CYCLE_RANGE)))
-	}
+	servoSteering.Set(values[0])
+	escThrottle.Set(values[1])
 }
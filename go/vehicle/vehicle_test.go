@@ -0,0 +1,49 @@
+package vehicle
+
+import (
+	"bbai64/esc"
+	"bbai64/hwtest"
+	"bbai64/pwm"
+	"bbai64/sysfs"
+	"reflect"
+	"testing"
+)
+
+func TestVehicleServos(t *testing.T) {
+	tree := hwtest.NewTree(t)
+	tree.AddBonePWM(0, "a")
+	tree.AddBonePWM(0, "b")
+	pwm.SetFS(tree)
+	defer pwm.SetFS(sysfs.Host)
+	escConfig.ArmingTime = 0
+	defer func() { escConfig = esc.DefaultConfig() }()
+
+	Initialize()
+	for _, channel := range []string{"a", "b"} {
+		dir := "/dev/bone/pwm/0/" + channel
+		if tree.Read(dir+"/period") != "20000000" || tree.Read(dir+"/polarity") != "inversed" || tree.Read(dir+"/enable") != "1" {
+			t.Errorf("channel %s is not initialized", channel)
+		}
+		if duty := tree.Read(dir + "/duty_cycle"); duty != "1500000" {
+			t.Errorf("unexpected duty cycle %s of channel %s", duty, channel)
+		}
+	}
+
+	UpdateWithState(&State{Inputs: []float64{1, -2}})
+	if duty := tree.Read("/dev/bone/pwm/0/a/duty_cycle"); duty != "1820000" {
+		t.Errorf("unexpected steering duty cycle %s", duty)
+	}
+	if duty := tree.Read("/dev/bone/pwm/0/b/duty_cycle"); duty != "1180000" {
+		t.Errorf("unexpected throttle duty cycle %s", duty)
+	}
+	tree.ResetWrites()
+	UpdateWithState(&State{Inputs: []float64{1, -1}})
+	if writes := tree.Writes(); len(writes) != 0 {
+		t.Errorf("expected unchanged values to be skipped, got %v", writes)
+	}
+
+	Reset()
+	if !reflect.DeepEqual(tree.WritesTo("/dev/bone/pwm/0/a/duty_cycle"), []string{"1500000"}) {
+		t.Errorf("unexpected steering reset %v", tree.WritesTo("/dev/bone/pwm/0/a/duty_cycle"))
+	}
+}